@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/ajanata/gotogen"
+
+	"github.com/ajanata/gotogen-hardware/internal/input"
+)
+
+// menuButton returns the menu button that a button event stands for, if any. Menu buttons act as they go down, and
+// again as they repeat. A button pressed while another is held is part of a chord, which isn't a menu button; the
+// first button of the chord has already acted by then, but nothing else does until they're all let go.
+func menuButton(e input.Event) gotogen.MenuButton {
+	if e.Kind != input.Press && e.Kind != input.Repeat || e.Kind == input.Press && e.With != 0 {
+		return gotogen.MenuButtonNone
+	}
+	switch {
+	case e.Has(input.Up):
+		return gotogen.MenuButtonUp
+	case e.Has(input.Down):
+		return gotogen.MenuButtonDown
+	case e.Has(input.Back):
+		return gotogen.MenuButtonBack
+	case e.Has(input.Menu):
+		return gotogen.MenuButtonMenu
+	}
+	return gotogen.MenuButtonNone
+}
+
+// pressedAlone reports whether e is button going down on its own, rather than as part of a chord. The side buttons act
+// only then, like the menu buttons.
+func pressedAlone(e input.Event, button int) bool {
+	return e.Kind == input.Press && e.With == 0 && e.Has(button)
+}
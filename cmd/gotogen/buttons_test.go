@@ -0,0 +1,61 @@
+//go:build sim
+
+// blink.go, which the badge builds need, imports machine, so this package only builds on a computer with the sim tag.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ajanata/gotogen"
+
+	"github.com/ajanata/gotogen-hardware/internal/input"
+)
+
+func TestMenuButton(t *testing.T) {
+	tests := []struct {
+		name string
+		e    input.Event
+		want gotogen.MenuButton
+	}{
+		{"press up", input.Event{Kind: input.Press, Buttons: 1 << input.Up}, gotogen.MenuButtonUp},
+		{"press down", input.Event{Kind: input.Press, Buttons: 1 << input.Down}, gotogen.MenuButtonDown},
+		{"press back", input.Event{Kind: input.Press, Buttons: 1 << input.Back}, gotogen.MenuButtonBack},
+		{"press menu", input.Event{Kind: input.Press, Buttons: 1 << input.Menu}, gotogen.MenuButtonMenu},
+		{"repeat down", input.Event{Kind: input.Repeat, Buttons: 1 << input.Down, Held: time.Second},
+			gotogen.MenuButtonDown},
+		{"press mic", input.Event{Kind: input.Press, Buttons: 1 << input.ToggleMic}, gotogen.MenuButtonNone},
+		{"release up", input.Event{Kind: input.Release, Buttons: 1 << input.Up}, gotogen.MenuButtonNone},
+		{"long press menu", input.Event{Kind: input.LongPress, Buttons: 1 << input.Menu}, gotogen.MenuButtonNone},
+		{"press down with up", input.Event{Kind: input.Press, Buttons: 1 << input.Down, With: 1 << input.Up},
+			gotogen.MenuButtonNone},
+		{"chord", input.Event{Kind: input.Chord, Buttons: 1<<input.Up | 1<<input.Down}, gotogen.MenuButtonNone},
+	}
+	for _, tt := range tests {
+		if got := menuButton(tt.e); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPressedAlone(t *testing.T) {
+	tests := []struct {
+		name string
+		e    input.Event
+		want bool
+	}{
+		{"press", input.Event{Kind: input.Press, Buttons: 1 << input.ToggleMic}, true},
+		{"other button", input.Event{Kind: input.Press, Buttons: 1 << input.ToggleTouch}, false},
+		{"in a chord", input.Event{Kind: input.Press, Buttons: 1 << input.ToggleMic, With: 1 << input.ToggleTouch},
+			false},
+		{"release", input.Event{Kind: input.Release, Buttons: 1 << input.ToggleMic}, false},
+		{"long press", input.Event{Kind: input.LongPress, Buttons: 1 << input.ToggleMic}, false},
+		{"chord", input.Event{Kind: input.Chord, Buttons: 1<<input.ToggleMic | 1<<input.Up}, false},
+	}
+	for _, tt := range tests {
+		if got := pressedAlone(tt.e, input.ToggleMic); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
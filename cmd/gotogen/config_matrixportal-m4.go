@@ -0,0 +1,120 @@
+//go:build matrixportal_m4
+
+package main
+
+import (
+	"errors"
+	"machine"
+	"strconv"
+	"time"
+
+	"github.com/ajanata/textbuf"
+
+	"github.com/ajanata/gotogen-hardware/internal/config"
+	"github.com/ajanata/gotogen-hardware/internal/tz"
+)
+
+const (
+	uploadTimeout = time.Minute
+	maxUploadSize = 4096
+)
+
+var (
+	errUploadTimeout = errors.New("timed out")
+	errUploadSize    = errors.New("too big")
+)
+
+// loadConfig reads config.txt from the filesystem, if available, and applies it over the compiled-in defaults.
+func (d *driver) loadConfig(buf *textbuf.Buffer) {
+	if d.fs == nil {
+		return
+	}
+
+	_ = buf.Print("Config")
+	cfg, err := config.Load(d.fs)
+	if err != nil {
+		println("loading config:", err.Error())
+		_ = buf.PrintlnInverse(": " + err.Error())
+		return
+	}
+	_ = buf.Println(": " + strconv.Itoa(len(cfg.Networks)) + " networks")
+	d.applyConfig(cfg)
+}
+
+func (d *driver) applyConfig(cfg *config.Config) {
+	d.networks = cfg.Networks
+	if cfg.TimeZone != "" {
+		if loc, err := tz.Load(cfg.TimeZone); err != nil {
+			println("config time zone:", err.Error())
+		} else {
+			timeZone = cfg.TimeZone
+			time.Local = loc
+		}
+	}
+	if len(cfg.NTPServers) > 0 {
+		ntpServers = cfg.NTPServers
+	}
+	if cfg.ResyncInterval > 0 {
+		resyncInterval = cfg.ResyncInterval
+	}
+}
+
+// uploadConfig receives a new config.txt over the USB serial port, and saves it if it is valid.
+func (d *driver) uploadConfig() {
+	d.g.Busy(func(buf *textbuf.Buffer) {
+		buf.AutoFlush = true
+		if d.fs == nil {
+			_ = buf.PrintlnInverse("No filesystem, format flash first.")
+			return
+		}
+
+		_ = buf.Println("Send config.txt over USB serial, then a line with only EOF.")
+		data, err := readSerialUpload()
+		if err != nil {
+			_ = buf.PrintlnInverse("Upload: " + err.Error())
+			return
+		}
+
+		_ = buf.Print("Saving")
+		cfg, err := config.Save(d.fs, data)
+		if err != nil {
+			_ = buf.PrintlnInverse(": " + err.Error())
+			return
+		}
+		_ = buf.Println(": " + strconv.Itoa(len(cfg.Networks)) + " networks")
+		_ = buf.Println("Reboot to apply.")
+	})
+}
+
+// readSerialUpload reads lines from the serial port until one is "EOF", and returns the lines before it.
+func readSerialUpload() ([]byte, error) {
+	var data, line []byte
+	deadline := time.Now().Add(uploadTimeout)
+	for time.Now().Before(deadline) {
+		if machine.Serial.Buffered() == 0 {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		c, err := machine.Serial.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch c {
+		case '\r':
+		case '\n':
+			if string(line) == "EOF" {
+				return data, nil
+			}
+			data = append(data, line...)
+			data = append(data, '\n')
+			line = line[:0]
+		default:
+			line = append(line, c)
+		}
+		if len(data)+len(line) > maxUploadSize {
+			return nil, errUploadSize
+		}
+	}
+	return nil, errUploadTimeout
+}
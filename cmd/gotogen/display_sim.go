@@ -0,0 +1,214 @@
+//go:build sim
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// simDisplay is an in-memory display. Drawing goes to a back buffer, and Display copies it to the front buffer that
+// the renderer reads.
+type simDisplay struct {
+	name string
+	// monochrome displays show any non-black pixel as white, like the SSD1306
+	mono bool
+
+	mu    sync.Mutex
+	back  *image.RGBA
+	front *image.RGBA
+	dirty bool
+	// frames counts calls to Display
+	frames int
+}
+
+func newSimDisplay(name string, w, h int, mono bool) *simDisplay {
+	return &simDisplay{
+		name:  name,
+		mono:  mono,
+		back:  image.NewRGBA(image.Rect(0, 0, w, h)),
+		front: image.NewRGBA(image.Rect(0, 0, w, h)),
+	}
+}
+
+func (s *simDisplay) Size() (x, y int16) {
+	b := s.back.Bounds()
+	return int16(b.Dx()), int16(b.Dy())
+}
+
+func (s *simDisplay) SetPixel(x, y int16, c color.RGBA) {
+	if s.mono {
+		if c.R|c.G|c.B != 0 {
+			c = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+		} else {
+			c = color.RGBA{A: 0xFF}
+		}
+	}
+	s.back.SetRGBA(int(x), int(y), c)
+}
+
+func (s *simDisplay) Display() error {
+	s.mu.Lock()
+	copy(s.front.Pix, s.back.Pix)
+	s.dirty = true
+	s.frames++
+	s.mu.Unlock()
+	return nil
+}
+
+func (*simDisplay) CanUpdateNow() bool { return true }
+
+// snapshot returns a copy of the front buffer and its frame number, if it changed since the last snapshot. Otherwise
+// the image is nil.
+func (s *simDisplay) snapshot() (*image.RGBA, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil, s.frames
+	}
+	s.dirty = false
+	img := image.NewRGBA(s.front.Rect)
+	copy(img.Pix, s.front.Pix)
+	return img, s.frames
+}
+
+// current returns a copy of the front buffer.
+func (s *simDisplay) current() *image.RGBA {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img := image.NewRGBA(s.front.Rect)
+	copy(img.Pix, s.front.Pix)
+	return img
+}
+
+// renderer periodically draws the displays that changed.
+type renderer interface {
+	render(d *simDisplay, img *image.RGBA, frame int) error
+}
+
+func runRenderer(r renderer, interval time.Duration, displays ...*simDisplay) {
+	for range time.Tick(interval) {
+		for _, d := range displays {
+			img, frame := d.snapshot()
+			if img == nil {
+				continue
+			}
+			if err := r.render(d, img, frame); err != nil {
+				fmt.Fprintln(os.Stderr, "rendering "+d.name+":", err)
+			}
+		}
+	}
+}
+
+// ansiRenderer draws displays in the terminal, two pixels per character cell using half blocks, one below the other.
+type ansiRenderer struct {
+	// brightness scales the face colours, like the LED panel's brightness does
+	brightness func() uint8
+	// terminal row each display starts on, 1-based
+	rows map[*simDisplay]int
+	sb   strings.Builder
+}
+
+func newANSIRenderer(brightness func() uint8, displays ...*simDisplay) *ansiRenderer {
+	r := &ansiRenderer{
+		brightness: brightness,
+		rows:       make(map[*simDisplay]int),
+	}
+	row := 1
+	for _, d := range displays {
+		r.rows[d] = row
+		_, h := d.Size()
+		row += int(h+1)/2 + 1
+	}
+	// clear the screen and hide the cursor
+	fmt.Print("\x1b[2J\x1b[?25l")
+	return r
+}
+
+// restore shows the cursor again and moves it below the displays.
+func (r *ansiRenderer) restore() {
+	last := 0
+	for d, row := range r.rows {
+		_, h := d.Size()
+		if end := row + int(h+1)/2; end > last {
+			last = end
+		}
+	}
+	fmt.Printf("\x1b[0m\x1b[%d;1H\x1b[?25h\n", last+1)
+}
+
+func (r *ansiRenderer) render(d *simDisplay, img *image.RGBA, frame int) error {
+	b := img.Bounds()
+	scale := uint16(0xFF)
+	if !d.mono && r.brightness != nil {
+		scale = uint16(r.brightness())
+	}
+
+	sb := &r.sb
+	sb.Reset()
+	for y := 0; y < b.Dy(); y += 2 {
+		fmt.Fprintf(sb, "\x1b[%d;1H", r.rows[d]+y/2)
+		// only change colours when they change, which for the menu is rarely
+		var lastTop, lastBottom color.RGBA
+		for x := 0; x < b.Dx(); x++ {
+			top := dim(img.RGBAAt(x, y), scale)
+			bottom := dim(img.RGBAAt(x, y+1), scale)
+			if x == 0 || top != lastTop {
+				fmt.Fprintf(sb, "\x1b[38;2;%d;%d;%dm", top.R, top.G, top.B)
+			}
+			if x == 0 || bottom != lastBottom {
+				fmt.Fprintf(sb, "\x1b[48;2;%d;%d;%dm", bottom.R, bottom.G, bottom.B)
+			}
+			lastTop, lastBottom = top, bottom
+			sb.WriteString("▀")
+		}
+		sb.WriteString("\x1b[0m")
+	}
+	fmt.Fprintf(sb, "\x1b[%d;1H%s: frame %d", r.rows[d]+(b.Dy()+1)/2, d.name, frame)
+	_, err := os.Stdout.WriteString(sb.String())
+	return err
+}
+
+func dim(c color.RGBA, scale uint16) color.RGBA {
+	return color.RGBA{
+		R: uint8(uint16(c.R) * scale / 0xFF),
+		G: uint8(uint16(c.G) * scale / 0xFF),
+		B: uint8(uint16(c.B) * scale / 0xFF),
+		A: 0xFF,
+	}
+}
+
+// pngRenderer writes changed frames to PNG files named for the display and frame number.
+type pngRenderer struct {
+	dir string
+}
+
+func newPNGRenderer(dir string) (*pngRenderer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &pngRenderer{dir: dir}, nil
+}
+
+func (r *pngRenderer) render(d *simDisplay, img *image.RGBA, frame int) error {
+	return writePNG(filepath.Join(r.dir, fmt.Sprintf("%s-%06d.png", d.name, frame)), img)
+}
+
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
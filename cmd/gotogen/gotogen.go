@@ -1,31 +1,79 @@
 package main
 
-import (
-	"machine"
-	"time"
-)
+import "time"
 
+// defaults for settings that can be changed in config.txt on the flash filesystem
 var (
-	// TODO better way to set these. for now, create a config.go and set them in an init()
-	wifiSSID     string
-	wifiPassword string
-	tzOffset     time.Duration
+	// POSIX TZ string, see tz.Parse; this is the default unless config.txt sets one or one is picked from the menu
+	timeZone = "UTC0"
+	// NTP servers (host:port) to query; the lowest-delay sample from any of them is used
+	ntpServers = []string{
+		"time.nist.gov:123",
+		"pool.ntp.org:123",
+		"time.google.com:123",
+	}
+	// how often to re-sync the time from NTP in the background, if Wi-Fi is configured; 0 disables
+	resyncInterval = 6 * time.Hour
 )
 
-func blink() {
-	led := machine.LED
-	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	led.High()
-	time.Sleep(100 * time.Millisecond)
-	led.Low()
-	time.Sleep(100 * time.Millisecond)
+// time zones offered in the menu
+var timeZones = []struct {
+	name string
+	tz   string
+}{
+	{"UTC", "UTC0"},
+	{"US Pacific", "PST8PDT,M3.2.0,M11.1.0"},
+	{"US Mountain", "MST7MDT,M3.2.0,M11.1.0"},
+	{"Arizona", "MST7"},
+	{"US Central", "CST6CDT,M3.2.0,M11.1.0"},
+	{"US Eastern", "EST5EDT,M3.2.0,M11.1.0"},
+	{"UK", "GMT0BST,M3.5.0/1,M10.5.0"},
+	{"Central Europe", "CET-1CEST,M3.5.0,M10.5.0/3"},
+	{"Eastern Europe", "EET-2EEST,M3.5.0/3,M10.5.0/4"},
+	{"Japan", "JST-9"},
+	{"Australia East", "AEST-10AEDT,M10.1.0,M4.1.0/3"},
+	{"New Zealand", "NZST-12NZDT,M9.5.0,M4.1.0/3"},
+}
+
+// tzCustom is a zone from config.txt that isn't one of timeZones, which the menu offers as "Custom".
+var tzCustom string
+
+// tzNames returns the menu labels for timeZones, plus "Custom" if timeZone isn't one of them.
+func tzNames() []string {
+	names := make([]string, len(timeZones), len(timeZones)+1)
+	for i, z := range timeZones {
+		names[i] = z.name
+	}
+	if tzIndex(timeZone) < 0 {
+		tzCustom = timeZone
+	}
+	if tzCustom != "" {
+		names = append(names, "Custom")
+	}
+	return names
+}
+
+// tzActive returns the menu index of timeZone: its index in timeZones, or the "Custom" entry after them.
+func tzActive() uint8 {
+	if i := tzIndex(timeZone); i >= 0 {
+		return uint8(i)
+	}
+	return uint8(len(timeZones))
+}
+
+// tzOption returns the TZ string for menu index s.
+func tzOption(s uint8) string {
+	if int(s) < len(timeZones) {
+		return timeZones[s].tz
+	}
+	return tzCustom
 }
 
-func earlyPanic(err error) {
-	for i := 0; ; i++ {
-		blink()
-		if i%5 == 0 {
-			println(err)
+func tzIndex(tz string) int {
+	for i, z := range timeZones {
+		if z.tz == tz {
+			return i
 		}
 	}
+	return -1
 }
@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"runtime/interrupt"
 	"strconv"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -26,14 +27,37 @@ import (
 	"tinygo.org/x/tinyfs"
 	"tinygo.org/x/tinyfs/littlefs"
 
+	"github.com/ajanata/gotogen-hardware/internal/drift"
+	"github.com/ajanata/gotogen-hardware/internal/hal"
+	"github.com/ajanata/gotogen-hardware/internal/input"
 	"github.com/ajanata/gotogen-hardware/internal/mic"
 	"github.com/ajanata/gotogen-hardware/internal/ntp"
+	"github.com/ajanata/gotogen-hardware/internal/settings"
+	"github.com/ajanata/gotogen-hardware/internal/tz"
+	"github.com/ajanata/gotogen-hardware/internal/wifi"
 )
 
 // const pcf8574Address = 0x20 // adafruit breakout
 const pcf8574Address = pcf8574.DefaultAddress // bare chip
 
-const ntpHost = "time.nist.gov:123"
+// the PCF8574's interrupt line, which it pulls low when its pins change until they're read
+const gpioInt = machine.A3 // PA06
+
+// how often to read the PCF8574 even if it hasn't interrupted, in case an interrupt was missed
+const gpioPollInterval = 250 * time.Millisecond
+
+// number of NTP exchanges with each server
+const ntpSamples = 4
+
+// mic sampling; a longer window is steadier but slower to react, and viseme classification needs at least 10ms
+const (
+	micSampleRate = 15625
+	micWindow     = 16 * time.Millisecond
+	// cuts out rumble from fans and handling noise inside the helmet
+	micHighPass = 150
+	// the VAD is updated at most this often, however often Talking, MouthOpenness and Viseme are called
+	micUpdateInterval = 5 * time.Millisecond
+)
 
 // we're using SERCOM4 for SPI on the built-in matrix connector, so we have to define it ourselves
 var matrixSPI = machine.SPI{
@@ -84,7 +108,6 @@ type driver struct {
 
 	np ws2812.Device
 
-	lastButton   byte
 	menuDisp     *dispWrapper
 	faceDisp     *rgbWrapper
 	rtc          pcf8523.Device
@@ -92,20 +115,39 @@ type driver struct {
 	accel        *lis3dh.Device
 	fl           *flash.Device
 	fs           tinyfs.Filesystem
-	gpio         *pcf8574.Device
-	touch        *mpr121.Device
+	bus          hal.I2C
+	buttons      *input.Buttons
+	buttonEvents *input.Decoder
 	touchEnabled bool
 	micEnabled   bool
+	link         wifi.Link
+	networks     []wifi.Network
+
+	// held while Wi-Fi is in use for NTP
+	timeLock sync.Mutex
+	// held while the USB serial port carries data rather than log messages; the background resync holds it too, so
+	// that it doesn't log in the middle
+	serialLock sync.Mutex
+	// held while using the RTC and the drift measurement, which the menu and the background resync both do
+	rtcLock   sync.Mutex
+	drift     drift.Estimator
+	rtcOffset int8
 
 	mic        *mic.Mic
-	talkCutoff float32
+	vad        *mic.VAD
+	lastListen time.Time
+	classifier *mic.Classifier
+	micSamples []uint16
+
+	// as loaded from flash; saveSettings updates it from the fields above
+	settings settings.Settings
 }
 
 var d = driver{
-	np: ws2812.New(machine.NEOPIXEL),
-
-	// TODO load from settings
-	talkCutoff: 3000,
+	np:           ws2812.New(machine.NEOPIXEL),
+	bus:          hal.NewLockedI2C(machine.I2C0),
+	buttonEvents: input.NewDecoder(),
+	vad:          mic.NewVAD(),
 }
 
 type dispWrapper struct {
@@ -124,7 +166,11 @@ func main() {
 	machine.NEOPIXEL.Configure(machine.PinConfig{Mode: machine.PinOutput})
 	_ = d.np.WriteColors([]color.RGBA{{R: 0x30, B: 0x30}})
 
-	time.Local = time.FixedZone("local", int(tzOffset.Seconds()))
+	if loc, err := tz.Load(timeZone); err != nil {
+		println("time zone:", err.Error())
+	} else {
+		time.Local = loc
+	}
 	time.Sleep(time.Second)
 	err := machine.I2C0.Configure(machine.I2CConfig{
 		SCL:       machine.I2C0_SCL_PIN,
@@ -198,6 +244,10 @@ func oledDMAInt(i interrupt.Interrupt) {
 	d.menuDisp.SPITXComplete(i)
 }
 
+func gpioInterrupt(machine.Pin) {
+	d.buttons.Interrupt()
+}
+
 func (w *dispWrapper) CanUpdateNow() bool {
 	return !w.Busy()
 }
@@ -254,7 +304,7 @@ func (d *driver) EarlyInit() (faceDisplay gotogen.Display, err error) {
 	// configure buttons
 	machine.BUTTON_UP.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 	machine.BUTTON_DOWN.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
-	// TODO configure "interrupt" for pcf8574
+	gpioInt.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 
 	return d.faceDisp, nil
 }
@@ -262,6 +312,12 @@ func (d *driver) EarlyInit() (faceDisplay gotogen.Display, err error) {
 func (d *driver) LateInit(buf *textbuf.Buffer) {
 	var err error
 
+	d.initFlash(buf)
+	d.loadSettings(buf)
+	// after the settings, so that anything set explicitly in config.txt wins
+	d.loadConfig(buf)
+
+	d.link = wifi.NewNetlink(d.networks)
 	d.initRTC(buf)
 
 	// boop sensor isn't working through the visor :(
@@ -287,7 +343,7 @@ func (d *driver) LateInit(buf *textbuf.Buffer) {
 
 	_ = buf.Print("Accelerometer")
 	d.waitForDMA()
-	accel := lis3dh.New(machine.I2C0)
+	accel := lis3dh.New(d.bus)
 	d.accel = &accel
 	d.accel.Address = 0x19
 	d.accel.Configure()
@@ -302,17 +358,29 @@ func (d *driver) LateInit(buf *textbuf.Buffer) {
 	}
 
 	_ = buf.Print("Mic")
-	d.mic = mic.New(machine.PA07, 100)
-
-	_ = buf.Print(".\nGPIO")
-	d.gpio = pcf8574.New(machine.I2C0)
-	d.gpio.Configure(pcf8574.Config{
-		Address: pcf8574Address,
-	})
+	d.mic = mic.New(mic.NewADCSource(hal.NewFreeRunningADC(machine.PA07), hal.NewTC0(), micSampleRate), micWindow)
+	d.mic.SetHighPass(micHighPass)
+	d.classifier = mic.NewClassifier(d.mic.SampleRate())
+	d.micSamples = make([]uint16, d.mic.Size())
+	_ = buf.Println(": " + strconv.Itoa(int(d.mic.SampleRate())) + " Hz")
+
+	_ = buf.Print("GPIO")
+	d.buttons = input.New(d.bus, machine.BUTTON_UP, machine.BUTTON_DOWN, pcf8574Address)
+	err = d.buttons.Configure()
+	if err != nil {
+		println("gpio: " + err.Error())
+		_ = buf.PrintlnInverse(": " + err.Error())
+	} else if err := gpioInt.SetInterrupt(machine.PinFalling, gpioInterrupt); err != nil {
+		println("gpio interrupt: " + err.Error())
+		_ = buf.PrintlnInverse(": polling")
+	} else {
+		d.buttons.EnableInterrupt(gpioPollInterval)
+		_ = buf.Println(".")
+	}
 
-	_ = buf.Print(".\nCapacitive Touch")
-	d.touch = mpr121.New(machine.I2C0)
-	err = d.touch.Configure(mpr121.Config{
+	_ = buf.Print("Capacitive Touch")
+	touch := mpr121.New(d.bus)
+	err = touch.Configure(mpr121.Config{
 		Address:          mpr121.DefaultAddress,
 		TouchThreshold:   0x10,
 		ReleaseThreshold: 0x05,
@@ -322,15 +390,24 @@ func (d *driver) LateInit(buf *textbuf.Buffer) {
 	if err != nil {
 		println("capacitive touch: " + err.Error())
 		_ = buf.PrintlnInverse(": " + err.Error())
-		d.touch = nil
 	} else {
+		d.buttons.SetTouch(mpr121.DefaultAddress)
 		_ = buf.Println(".")
 	}
 
+	if resyncInterval > 0 && len(d.networks) > 0 {
+		go d.resyncLoop()
+	}
+
+	// turn off the NeoPixel
+	_ = d.np.WriteColors([]color.RGBA{{}})
+}
+
+func (d *driver) initFlash(buf *textbuf.Buffer) {
 	_ = buf.Print("Flash")
 	f := flash.NewQSPI(machine.D42, machine.D41, machine.D43, machine.D44, machine.D45, machine.D46)
 	// TODO we know we're only going to have a GD25Q16 so make a device identifier specifically for that for code size
-	err = f.Configure(&flash.DeviceConfig{Identifier: flash.DefaultDeviceIdentifier})
+	err := f.Configure(&flash.DeviceConfig{Identifier: flash.DefaultDeviceIdentifier})
 	if err != nil {
 		println("flash:", err)
 		_ = buf.PrintlnInverse(": " + err.Error())
@@ -361,15 +438,64 @@ func (d *driver) LateInit(buf *textbuf.Buffer) {
 			}
 		}
 	}
+}
 
-	// turn off the NeoPixel
-	_ = d.np.WriteColors([]color.RGBA{{}})
+// loadSettings reads the saved settings, if the filesystem is available, and applies them.
+func (d *driver) loadSettings(buf *textbuf.Buffer) {
+	d.settings = settings.Defaults()
+	if d.fs != nil {
+		_ = buf.Print("Settings")
+		var err error
+		d.settings, err = settings.Load(d.fs)
+		if err != nil {
+			println("loading settings:", err.Error())
+			_ = buf.PrintlnInverse(": defaults")
+		} else {
+			_ = buf.Println(".")
+		}
+	}
+
+	s := d.settings
+	d.setBrightness(s.Brightness)
+	d.vad.MinLevel = float32(s.TalkCutoff)
+	if s.VADOpen != 0 && s.VADClose != 0 {
+		d.vad.Open = float32(s.VADOpen) / 10
+		d.vad.Close = float32(s.VADClose) / 10
+	}
+	d.micEnabled = s.MicEnabled
+	d.touchEnabled = s.TouchEnabled
+	d.rtcOffset = s.RTCOffset
+	if s.TimeZone != "" {
+		if loc, err := tz.Load(s.TimeZone); err != nil {
+			println("saved time zone:", err.Error())
+		} else {
+			timeZone = s.TimeZone
+			time.Local = loc
+		}
+	}
+}
+
+// saveSettings writes the current settings to flash, if the filesystem is available.
+func (d *driver) saveSettings() {
+	if d.fs == nil {
+		return
+	}
+
+	d.settings.Brightness = uint8(d.faceDisp.Brightness() >> 3)
+	d.settings.TalkCutoff = uint16(d.vad.MinLevel)
+	d.settings.MicEnabled = d.micEnabled
+	d.settings.TouchEnabled = d.touchEnabled
+	d.settings.RTCOffset = d.rtcOffset
+	err := settings.Save(d.fs, d.settings)
+	if err != nil {
+		println("saving settings:", err.Error())
+	}
 }
 
 func (d *driver) initRTC(buf *textbuf.Buffer) {
 	_ = buf.Print("Reading RTC")
 	d.waitForDMA()
-	d.rtc = pcf8523.New(machine.I2C0)
+	d.rtc = pcf8523.New(d.bus)
 	rtcGood := false
 
 	err := d.rtc.Reset()
@@ -378,6 +504,15 @@ func (d *driver) initRTC(buf *textbuf.Buffer) {
 		_ = buf.PrintlnInverse(": " + err.Error())
 		_ = buf.Println("Skipping RTC")
 	} else {
+		// resetting clears the offset register
+		if d.rtcOffset != 0 {
+			d.rtcLock.Lock()
+			err := d.setRTCOffset(d.rtcOffset)
+			d.rtcLock.Unlock()
+			if err != nil {
+				println("rtc offset:", err)
+			}
+		}
 		now, err := d.rtc.ReadTime()
 		if err != nil {
 			println("rtc read:", err)
@@ -398,13 +533,15 @@ func (d *driver) initRTC(buf *textbuf.Buffer) {
 
 	if !rtcGood {
 		// TODO check a button for bypass (e.g. if known that wifi network isn't in range)
-		err := ntp.NTP(ntpHost, wifiSSID, wifiPassword, buf)
+		res, err := d.syncTime(buf)
 		if err != nil {
-			println("ntp:", err)
+			println("ntp:", err.Error())
+			_ = buf.PrintlnInverse("ntp: " + err.Error())
 		} else {
-			println(time.Now().String())
-			d.waitForDMA()
-			err := d.rtc.SetTime(time.Now().In(time.UTC))
+			println(time.Now().String(), "delay", res.Delay.String(), "stratum", res.Stratum)
+			d.rtcLock.Lock()
+			err := d.setRTC()
+			d.rtcLock.Unlock()
 			if err != nil {
 				println("setting rtc:", err)
 			}
@@ -413,110 +550,45 @@ func (d *driver) initRTC(buf *textbuf.Buffer) {
 	}
 }
 
-const (
-	ioBack = iota
-	ioMenu
-	ioUp
-	ioDown
-	ioToggleMic
-	ioExtra2
-	ioToggleTouch
-	ioTouchEvent
-)
-
-const (
-	touchMenu = iota
-	touchBack
-	touchDown
-	touchUp
-	touchExtra1
-	touchExtra2
-)
-
 func (d *driver) PressedButton() gotogen.MenuButton {
-	cur := byte(0)
-	// buttons use pull-up resistors and short to ground, so they are *false* when pressed
-	if !machine.BUTTON_UP.Get() {
-		cur |= 1 << gotogen.MenuButtonUp
-	}
-	if !machine.BUTTON_DOWN.Get() {
-		cur |= 1 << gotogen.MenuButtonDown
+	now := time.Now()
+	cur, err := d.buttons.Read(d.touchEnabled, now)
+	if err != nil {
+		println("reading buttons: " + err.Error())
 	}
 
-	// TODO check the "interrupt" input from the PCF8574 before asking for its values
-	r, err := d.gpio.Read()
-	if err != nil {
-		println("reading GPIO expander: " + err.Error())
-	} else {
-		if !r.Pin(ioBack) {
-			cur |= 1 << ioBack
-		}
-		if !r.Pin(ioMenu) {
-			cur |= 1 << ioMenu
-		}
-		if !r.Pin(ioUp) {
-			cur |= 1 << ioUp
+	d.buttonEvents.Update(cur, now)
+	for {
+		e, ok := d.buttonEvents.Next()
+		if !ok {
+			return gotogen.MenuButtonNone
 		}
-		if !r.Pin(ioDown) {
-			cur |= 1 << ioDown
+		if pressedAlone(e, input.ToggleMic) {
+			d.micEnabled = !d.micEnabled
+			d.saveSettings()
 		}
-		if !r.Pin(ioToggleMic) {
-			cur |= 1 << ioToggleMic
+		if pressedAlone(e, input.ToggleTouch) {
+			d.touchEnabled = !d.touchEnabled
+			d.saveSettings()
 		}
-		if !r.Pin(ioToggleTouch) {
-			cur |= 1 << ioToggleTouch
-		}
-
-		// capacitive touch "interrupt"
-		if !r.Pin(ioTouchEvent) && d.touch != nil {
-			tr, err := d.touch.Status()
-			if err != nil {
-				println("reading capacitive touch: " + err.Error())
-			} else if d.touchEnabled {
-				if tr.Touched(touchMenu) || tr.Touched(touchExtra1) || tr.Touched(touchExtra2) {
-					cur |= 1 << ioMenu
-				}
-				if tr.Touched(touchBack) {
-					cur |= 1 << ioBack
-				}
-				if tr.Touched(touchDown) {
-					cur |= 1 << ioDown
-				}
-				if tr.Touched(touchUp) {
-					cur |= 1 << ioUp
-				}
-			}
+		if b := menuButton(e); b != gotogen.MenuButtonNone {
+			return b
 		}
 	}
+}
 
-	if cur == d.lastButton {
-		// TODO key repeat
-		return gotogen.MenuButtonNone
-	}
-
-	d.lastButton = cur
-	// some button has changed
-	if cur&(1<<ioUp) > 0 {
-		return gotogen.MenuButtonUp
-	}
-	if cur&(1<<ioDown) > 0 {
-		return gotogen.MenuButtonDown
-	}
-	if cur&(1<<ioBack) > 0 {
-		return gotogen.MenuButtonBack
-	}
-	if cur&(1<<ioMenu) > 0 {
-		return gotogen.MenuButtonMenu
-	}
-	if cur&(1<<ioToggleMic) > 0 {
-		d.micEnabled = !d.micEnabled
-	}
-	if cur&(1<<ioToggleTouch) > 0 {
-		d.touchEnabled = !d.touchEnabled
-	}
-
-	// guess they let go of all the buttons
-	return gotogen.MenuButtonNone
+// showButtonStats shows how much I2C bus time reading the buttons has taken, and how much the PCF8574's interrupt has
+// saved by not reading it on every frame.
+func (d *driver) showButtonStats() {
+	d.g.Busy(func(buf *textbuf.Buffer) {
+		s := d.buttons.Stats()
+		_ = buf.Println("Polls: " + strconv.Itoa(s.Polls))
+		_ = buf.Println("GPIO reads: " + strconv.Itoa(s.Reads))
+		_ = buf.Println("GPIO bus: " + s.ExpanderTime.Round(time.Microsecond).String())
+		_ = buf.Println("Touch reads: " + strconv.Itoa(s.TouchReads))
+		_ = buf.Println("Touch bus: " + s.TouchTime.Round(time.Microsecond).String())
+		_ = buf.Println("Saved: " + s.Saved().Round(time.Microsecond).String())
+	})
 }
 
 func (d *driver) BoopDistance() (uint8, gotogen.SensorStatus) {
@@ -545,7 +617,35 @@ func (d *driver) Accelerometer() (int32, int32, int32, gotogen.SensorStatus) {
 }
 
 func (d *driver) Talking() bool {
-	return d.micEnabled && d.mic.Value() > d.talkCutoff
+	return d.micEnabled && d.listen().Talking()
+}
+
+// MouthOpenness returns how far open the mouth should be, from 0 to 255, for faces that open the mouth proportionally
+// to loudness. Talking is true exactly when it is non-zero.
+func (d *driver) MouthOpenness() uint8 {
+	if !d.micEnabled {
+		return 0
+	}
+	return d.listen().Openness()
+}
+
+// Viseme returns the rough mouth shape for what the wearer is saying, and how confident that is from 0 to 1.
+func (d *driver) Viseme() (mic.Viseme, float32) {
+	if !d.micEnabled || !d.listen().Talking() {
+		return mic.VisemeClosed, 1
+	}
+	n := d.mic.Snapshot(d.micSamples)
+	return d.classifier.Classify(d.micSamples[:n])
+}
+
+// listen feeds the current mic level to the VAD, unless it was done very recently, and returns the VAD.
+func (d *driver) listen() *mic.VAD {
+	now := time.Now()
+	if now.Sub(d.lastListen) >= micUpdateInterval {
+		d.vad.Update(d.mic.Value(), now)
+		d.lastListen = now
+	}
+	return d.vad
 }
 
 func (d *driver) MenuItems() []gotogen.Item {
@@ -553,6 +653,7 @@ func (d *driver) MenuItems() []gotogen.Item {
 	if d.fs != nil {
 		formatLabel = "Yes (WILL ERASE)"
 	}
+	cutoffs, cutoff := d.talkCutoffOptions()
 
 	m := []gotogen.Item{
 		&gotogen.SettingItem{
@@ -560,18 +661,45 @@ func (d *driver) MenuItems() []gotogen.Item {
 			Options: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
 			Active:  uint8(d.faceDisp.Brightness() >> 3),
 			Default: 4,
-			Apply:   d.setBrightness,
+			Apply:   d.applyBrightness,
 		},
 		&gotogen.ActionItem{
 			Name:   "Set time from NTP",
 			Invoke: d.setTime,
 		},
+		&gotogen.SettingItem{
+			Name:    "Time zone",
+			Options: tzNames(),
+			Active:  tzActive(),
+			Apply:   d.setTimeZone,
+		},
 		&gotogen.SettingItem{
 			Name:    "Talking cutoff",
-			Options: []string{"2000", "2500", "3000", "3500", "4000", "4500", "5000"},
-			Active:  uint8((d.talkCutoff - 2000) / 500),
+			Options: cutoffs,
+			Active:  cutoff,
 			Apply:   d.setTalkCutoff,
 		},
+		&gotogen.ActionItem{
+			Name:   "Calibrate mic",
+			Invoke: d.calibrateMic,
+		},
+		&gotogen.Menu{
+			Name: "Mic recording",
+			Items: []gotogen.Item{
+				&gotogen.ActionItem{
+					Name:   "Record " + strconv.Itoa(int(recordTime/time.Second)) + "s",
+					Invoke: d.recordMic,
+				},
+				&gotogen.ActionItem{
+					Name:   "Send over USB serial",
+					Invoke: d.sendRecording,
+				},
+			},
+		},
+		&gotogen.ActionItem{
+			Name:   "Upload config.txt",
+			Invoke: d.uploadConfig,
+		},
 		&gotogen.Menu{
 			Name: "Format flash",
 			Items: []gotogen.Item{
@@ -585,6 +713,15 @@ func (d *driver) MenuItems() []gotogen.Item {
 				},
 			},
 		},
+		&gotogen.Menu{
+			Name: "Debug",
+			Items: []gotogen.Item{
+				&gotogen.ActionItem{
+					Name:   "Button I2C stats",
+					Invoke: d.showButtonStats,
+				},
+			},
+		},
 	}
 
 	return m
@@ -605,30 +742,48 @@ func (d *driver) StatusLine() string {
 func (d *driver) setTime() {
 	d.g.Busy(func(buf *textbuf.Buffer) {
 		buf.AutoFlush = true
-		err := ntp.NTP(ntpHost, wifiSSID, wifiPassword, buf)
+		res, err := d.syncTime(buf)
 		if err != nil {
 			_ = buf.PrintlnInverse("ntp: " + err.Error())
 		} else {
 			_ = buf.Println(time.Now().Format(time.Stamp))
+			_ = buf.Println("Offset: " + res.Offset.Round(time.Millisecond).String())
+			_ = buf.Println("Delay: " + res.Delay.Round(time.Millisecond).String())
 			_ = buf.Print("Setting RTC")
-			d.waitForDMA()
-			err := d.rtc.SetTime(time.Now().In(time.UTC))
+			d.rtcLock.Lock()
+			err := d.setRTC()
+			d.rtcLock.Unlock()
 			if err != nil {
-				_ = buf.PrintlnInverse("rtc: " + err.Error())
+				_ = buf.PrintlnInverse(": " + err.Error())
+			} else {
+				_ = buf.Println(".")
 			}
-			_ = buf.Println(".")
 		}
 	})
 }
 
-func (d *driver) setTalkCutoff(s uint8) {
-	d.talkCutoff = 2000 + 500*float32(s)
+func (d *driver) setTimeZone(s uint8) {
+	loc, err := tz.Load(tzOption(s))
+	if err != nil {
+		println("time zone:", err.Error())
+		return
+	}
+	timeZone = tzOption(s)
+	time.Local = loc
+	// only a zone picked here is saved, so that one from config.txt isn't pinned over later edits to it
+	d.settings.TimeZone = timeZone
+	d.saveSettings()
 }
 
 func (d *driver) setBrightness(s uint8) {
 	d.faceDisp.SetBrightness(uint32(s) << 3)
 }
 
+func (d *driver) applyBrightness(s uint8) {
+	d.setBrightness(s)
+	d.saveSettings()
+}
+
 func (d *driver) formatFlash() {
 	d.g.Busy(func(buf *textbuf.Buffer) {
 		if d.fl == nil {
@@ -684,5 +839,6 @@ func (d *driver) formatFlash() {
 		}
 		_ = buf.Println(strconv.Itoa(size))
 		d.fs = fs
+		d.saveSettings()
 	})
 }
@@ -0,0 +1,439 @@
+//go:build sim
+
+// The simulator runs gotogen on a computer, with fake devices: the face and menu are drawn in the terminal or saved as
+// PNGs, and the keyboard stands in for the buttons. Build it with -tags sim:
+//
+//	go run -tags sim ./cmd/gotogen
+//
+// Keys: arrows or WASD to move through the menu (right/D/enter/space selects, left/A/backspace goes back), T to toggle
+// talking, M and C to toggle the mic and touch like the side buttons, and Q to quit.
+//
+// For repeatable runs, -trace plays back a script of inputs instead of reading the keyboard, on a virtual clock that
+// advances one frame each time gotogen polls the buttons; see traceEvent for the format. With -golden, the trace's snap
+// events compare the displays to images saved by an earlier run with -update, and the simulator exits with an error if
+// they differ:
+//
+//	go run -tags sim ./cmd/gotogen -render none -trace cmd/gotogen/testdata/menu.trace -golden frames/menu -update
+//	go run -tags sim ./cmd/gotogen -render none -trace cmd/gotogen/testdata/menu.trace -golden frames/menu
+//
+// go test -tags sim plays back each testdata/*.trace and compares what the driver gives gotogen, frame by frame, to
+// the .golden file next to it, and the displays at its snap events to the PNGs in the directory of the same name;
+// -update rewrites them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/ajanata/gotogen"
+	"github.com/ajanata/textbuf"
+
+	"github.com/ajanata/gotogen-hardware/internal/hal/fake"
+	"github.com/ajanata/gotogen-hardware/internal/input"
+	"github.com/ajanata/gotogen-hardware/internal/mic"
+	"github.com/ajanata/gotogen-hardware/internal/tz"
+)
+
+// where the fake expander and touch sensor are on the fake bus, like the badge's
+const (
+	simExpanderAddress = 0x20
+	simTouchAddress    = 0x5A
+)
+
+// how often to read the fake expander even if it hasn't interrupted, like the badge
+const simPollInterval = 250 * time.Millisecond
+
+// how long a tapped button is held down; long enough to get past the debounce
+const simTapTime = 50 * time.Millisecond
+
+// when the virtual clock starts, for playing back traces
+var simEpoch = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fake mic levels, roughly what the real mic reads in a quiet room and while talking
+const (
+	simNoiseLevel = 300
+	simTalkLevel  = 6000
+)
+
+type driver struct {
+	g *gotogen.Gotogen
+
+	faceDisp *simDisplay
+	menuDisp *simDisplay
+	keys     chan key
+	trace    *player
+	// restores the terminal and exits with a status code
+	exit func(code int)
+
+	// while playing back a trace, the clock is virtual: it advances by frame each time gotogen polls the buttons, so
+	// that a run doesn't depend on how fast the computer is. Otherwise frame is 0 and the wall clock is used.
+	frame time.Duration
+	clock time.Time
+
+	// the keyboard and trace work the fake devices, which are read like the real ones
+	bus          fake.I2C
+	up, down     fake.Pin
+	buttons      *input.Buttons
+	buttonEvents *input.Decoder
+
+	// buttons held down, and tapped recently, as bitmasks of the expander pins
+	held, tapped byte
+	// when each tapped button is let go
+	tapEnd [8]time.Time
+	// touch electrodes held down, as a bitmask
+	touched uint16
+	// whether the touch sensor is signalling a change, and how many times its status had been read when it started
+	touchEvent bool
+	touchReads int
+
+	// read by the renderer too
+	brightness   atomic.Uint32
+	micEnabled   bool
+	touchEnabled bool
+	micLevel     float32
+	accel        [3]int32
+	vad          *mic.VAD
+	lastListen   time.Time
+}
+
+// newDriver returns a driver with its fake devices set up like the badge's.
+func newDriver() (*driver, error) {
+	d := &driver{
+		keys:         make(chan key, 16),
+		buttonEvents: input.NewDecoder(),
+		micEnabled:   true,
+		micLevel:     simNoiseLevel,
+		vad:          mic.NewVAD(),
+	}
+	d.brightness.Store(4)
+	d.up.High, d.down.High = true, true
+	d.bus.Attach(simExpanderAddress, 1)
+	d.bus.Attach(simTouchAddress, 0x80)
+	d.buttons = input.New(&d.bus, &d.up, &d.down, simExpanderAddress)
+	if err := d.buttons.Configure(); err != nil {
+		return nil, err
+	}
+	d.buttons.SetTouch(simTouchAddress)
+	d.buttons.EnableInterrupt(simPollInterval)
+	d.faceDisp = newSimDisplay("face", 128, 32, false)
+	d.menuDisp = newSimDisplay("menu", 128, 64, true)
+	return d, nil
+}
+
+// play plays back events on a virtual clock advancing at fps.
+func (d *driver) play(events []traceEvent, fps int, golden string, update bool) {
+	d.trace = &player{events: events, golden: golden, update: update}
+	d.frame = time.Second / time.Duration(fps)
+	d.clock = simEpoch
+}
+
+// now returns the simulator's current time: the virtual clock while playing a trace, or the wall clock.
+func (d *driver) now() time.Time {
+	if d.frame == 0 {
+		return time.Now()
+	}
+	return d.clock
+}
+
+// blinker stands in for the LED.
+type blinker struct{}
+
+func (blinker) High() {}
+func (blinker) Low()  {}
+
+func main() {
+	render := flag.String("render", "ansi", "how to show the displays: ansi, png or none")
+	pngDir := flag.String("png", "frames", "directory for -render png")
+	interval := flag.Duration("interval", 33*time.Millisecond, "how often to render changed displays")
+	fps := flag.Int("fps", 60, "gotogen frame rate")
+	trace := flag.String("trace", "", "play back inputs from this file instead of the keyboard")
+	golden := flag.String("golden", "", "directory of golden images for the trace's snap events")
+	update := flag.Bool("update", false, "save the trace's snap events as the golden images, instead of comparing")
+	flag.Parse()
+
+	d, err := newDriver()
+	if err != nil {
+		earlyPanic(err)
+	}
+	if *trace != "" {
+		events, err := loadTrace(*trace)
+		if err != nil {
+			earlyPanic(err)
+		}
+		if *golden != "" && *update {
+			if err := os.MkdirAll(*golden, 0o755); err != nil {
+				earlyPanic(err)
+			}
+		}
+		d.play(events, *fps, *golden, *update)
+	}
+
+	if loc, err := tz.Load(timeZone); err != nil {
+		println("time zone:", err.Error())
+	} else {
+		time.Local = loc
+	}
+
+	restore := func() {}
+	switch *render {
+	case "ansi":
+		r := newANSIRenderer(d.faceBrightness, d.faceDisp, d.menuDisp)
+		restoreTerm := rawTerminal()
+		restore = func() {
+			r.restore()
+			restoreTerm()
+		}
+		go runRenderer(r, *interval, d.faceDisp, d.menuDisp)
+	case "png":
+		r, err := newPNGRenderer(*pngDir)
+		if err != nil {
+			earlyPanic(err)
+		}
+		go runRenderer(r, *interval, d.faceDisp, d.menuDisp)
+	case "none":
+	default:
+		earlyPanic(fmt.Errorf("unknown -render %q", *render))
+	}
+
+	if d.trace == nil {
+		go keyboard(os.Stdin, d.keys)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		d.keys <- keyQuit
+	}()
+	d.exit = func(code int) {
+		restore()
+		os.Exit(code)
+	}
+
+	g, err := gotogen.New(uint(*fps), d.menuDisp, blinker{}, d)
+	if err != nil {
+		restore()
+		earlyPanic(err)
+	}
+
+	d.g = g
+	err = g.Init()
+	if err != nil {
+		restore()
+		earlyPanic(err)
+	}
+
+	d.g.Run()
+}
+
+func earlyPanic(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func (d *driver) EarlyInit() (faceDisplay gotogen.Display, err error) {
+	return d.faceDisp, nil
+}
+
+func (d *driver) LateInit(buf *textbuf.Buffer) {
+	_ = buf.Println("Simulator")
+	_ = buf.Println("Keys: arrows, T talk, Q quit")
+}
+
+func (d *driver) PressedButton() gotogen.MenuButton {
+	if d.frame != 0 {
+		d.clock = d.clock.Add(d.frame)
+	}
+	now := d.now()
+	if d.trace != nil {
+		d.trace.play(d, now)
+	}
+	d.readKeys(now)
+	d.setInputs(now)
+
+	cur, err := d.buttons.Read(d.touchEnabled, now)
+	if err != nil {
+		println("reading buttons: " + err.Error())
+	}
+
+	d.buttonEvents.Update(cur, now)
+	for {
+		e, ok := d.buttonEvents.Next()
+		if !ok {
+			return gotogen.MenuButtonNone
+		}
+		if pressedAlone(e, input.ToggleMic) {
+			d.micEnabled = !d.micEnabled
+		}
+		if pressedAlone(e, input.ToggleTouch) {
+			d.touchEnabled = !d.touchEnabled
+		}
+		if b := menuButton(e); b != gotogen.MenuButtonNone {
+			return b
+		}
+	}
+}
+
+// readKeys handles the keys pressed since the last poll. Buttons are tapped, as the keyboard can't tell how long a key
+// is held.
+func (d *driver) readKeys(now time.Time) {
+	for {
+		select {
+		case k := <-d.keys:
+			switch k {
+			case keyUp:
+				d.tap(1<<input.Up, now)
+			case keyDown:
+				d.tap(1<<input.Down, now)
+			case keyBack:
+				d.tap(1<<input.Back, now)
+			case keyMenu:
+				d.tap(1<<input.Menu, now)
+			case keyToggleMic:
+				d.tap(1<<input.ToggleMic, now)
+			case keyToggleTouch:
+				d.tap(1<<input.ToggleTouch, now)
+			case keyTalk:
+				if d.micLevel < simTalkLevel {
+					d.micLevel = simTalkLevel
+				} else {
+					d.micLevel = simNoiseLevel
+				}
+			case keyQuit:
+				d.quit()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// tap holds buttons down for simTapTime. Tapping again before then holds them for longer, so a key held down on the
+// keyboard, which repeats, holds the button down.
+func (d *driver) tap(buttons byte, now time.Time) {
+	d.tapped |= buttons
+	for i := range d.tapEnd {
+		if buttons&(1<<i) != 0 {
+			d.tapEnd[i] = now.Add(simTapTime)
+		}
+	}
+}
+
+// setInputs sets the fake expander pins and touch sensor from the buttons and electrodes held down. Like the real ones,
+// the pins are low when pressed, and the expander interrupts when they change. The touch sensor pulls the touch event
+// pin low when the electrodes change, and lets go once its status has been read.
+func (d *driver) setInputs(now time.Time) {
+	for i, end := range d.tapEnd {
+		if !now.Before(end) {
+			d.tapped &^= 1 << i
+		}
+	}
+	reads := d.buttons.Stats().TouchReads
+	if d.bus.SetRegisters(simTouchAddress, 0, byte(d.touched), byte(d.touched>>8)) {
+		d.touchEvent = true
+		d.touchReads = reads
+	} else if d.touchEvent && reads != d.touchReads {
+		d.touchEvent = false
+	}
+
+	pins := d.held | d.tapped
+	if d.touchEvent {
+		pins |= 1 << input.TouchEvent
+	}
+	if d.bus.SetRegisters(simExpanderAddress, 0, ^pins) {
+		d.buttons.Interrupt()
+	}
+}
+
+func (d *driver) BoopDistance() (uint8, gotogen.SensorStatus) {
+	return 0, gotogen.SensorStatusUnavailable
+}
+
+func (d *driver) Accelerometer() (int32, int32, int32, gotogen.SensorStatus) {
+	return d.accel[0], d.accel[1], d.accel[2], gotogen.SensorStatusAvailable
+}
+
+func (d *driver) Talking() bool {
+	return d.micEnabled && d.listen().Talking()
+}
+
+// MouthOpenness returns how far open the mouth should be, from 0 to 255, like the badge's.
+func (d *driver) MouthOpenness() uint8 {
+	if !d.micEnabled {
+		return 0
+	}
+	return d.listen().Openness()
+}
+
+// listen feeds the fake mic level to the VAD, once for each time Talking and MouthOpenness are asked about together.
+func (d *driver) listen() *mic.VAD {
+	if now := d.now(); !now.Equal(d.lastListen) {
+		d.vad.Update(d.micLevel, now)
+		d.lastListen = now
+	}
+	return d.vad
+}
+
+func (d *driver) MenuItems() []gotogen.Item {
+	return []gotogen.Item{
+		&gotogen.SettingItem{
+			Name:    "Brightness",
+			Options: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
+			Active:  uint8(d.brightness.Load()),
+			Default: 4,
+			Apply: func(s uint8) {
+				d.brightness.Store(uint32(s))
+			},
+		},
+		&gotogen.SettingItem{
+			Name:    "Time zone",
+			Options: tzNames(),
+			Active:  tzActive(),
+			Apply:   d.setTimeZone,
+		},
+		&gotogen.ActionItem{
+			Name:   "Quit simulator",
+			Invoke: d.quit,
+		},
+	}
+}
+
+func (d *driver) StatusLine() string {
+	touch := "off"
+	if d.touchEnabled {
+		touch = "on"
+	}
+	mic := "off"
+	if d.micEnabled {
+		mic = "on"
+	}
+	return "Touch: " + touch + " Mic: " + mic
+}
+
+func (d *driver) quit() {
+	d.exit(0)
+}
+
+func (d *driver) setTimeZone(s uint8) {
+	loc, err := tz.Load(tzOption(s))
+	if err != nil {
+		println("time zone:", err.Error())
+		return
+	}
+	timeZone = tzOption(s)
+	time.Local = loc
+}
+
+// faceBrightness scales the brightness setting like the LED panel, where 10 is nearly full.
+func (d *driver) faceBrightness() uint8 {
+	b := int(d.brightness.Load()) << 3
+	// the panel is far brighter than a terminal, so don't let low settings disappear entirely
+	b = b*3 + 0x20
+	if b > 0xFF {
+		b = 0xFF
+	}
+	return uint8(b)
+}
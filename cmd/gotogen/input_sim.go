@@ -0,0 +1,104 @@
+//go:build sim
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// a key pressed in the simulator
+type key byte
+
+const (
+	keyNone key = iota
+	keyUp
+	keyDown
+	keyBack
+	keyMenu
+	keyTalk
+	keyToggleMic
+	keyToggleTouch
+	keyQuit
+)
+
+// keyboard reads keys from r, and sends them to keys. Letters count in either case. At the end of r it stops reading,
+// but doesn't quit, so that the simulator can run headless with stdin from /dev/null.
+func keyboard(r io.Reader, keys chan<- key) {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+
+		k := keyNone
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		switch c {
+		case 'w', 'k':
+			k = keyUp
+		case 's', 'j':
+			k = keyDown
+		case 'a', 'h', 0x7F, '\b':
+			k = keyBack
+		case 'd', 'l', ' ', '\r', '\n':
+			k = keyMenu
+		case 't':
+			k = keyTalk
+		case 'm':
+			k = keyToggleMic
+		case 'c':
+			k = keyToggleTouch
+		case 'q':
+			k = keyQuit
+		case 0x1B:
+			// arrow keys are ESC [ A through D
+			if b, _ := br.Peek(2); len(b) == 2 && b[0] == '[' {
+				_, _ = br.Discard(2)
+				switch b[1] {
+				case 'A':
+					k = keyUp
+				case 'B':
+					k = keyDown
+				case 'C':
+					k = keyMenu
+				case 'D':
+					k = keyBack
+				}
+			}
+		}
+		if k != keyNone {
+			keys <- k
+		}
+	}
+}
+
+// rawTerminal puts the terminal into cbreak mode, so that keys arrive without waiting for enter, and returns a function
+// that puts it back. It does nothing if stdin isn't a terminal.
+func rawTerminal() (restore func()) {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return func() {}
+	}
+	return func() {
+		_, _ = stty(strings.TrimSpace(saved))
+	}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
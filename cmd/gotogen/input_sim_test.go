@@ -0,0 +1,40 @@
+//go:build sim
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyboard(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []key
+	}{
+		{"wasd", []key{keyUp, keyBack, keyDown, keyMenu}},
+		// caps lock, or shift
+		{"WASD", []key{keyUp, keyBack, keyDown, keyMenu}},
+		{"tTmMcCqQ", []key{keyTalk, keyTalk, keyToggleMic, keyToggleMic, keyToggleTouch, keyToggleTouch, keyQuit,
+			keyQuit}},
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", []key{keyUp, keyDown, keyMenu, keyBack}},
+		{"kjhl \r\n\x7f", []key{keyUp, keyDown, keyBack, keyMenu, keyMenu, keyMenu, keyMenu, keyBack}},
+		{"xyz?", nil},
+		// the end of input isn't a quit, so that it can run with no input at all
+		{"", nil},
+	}
+	for _, tt := range tests {
+		keys := make(chan key, 16)
+		// returns at the end of the input
+		keyboard(strings.NewReader(tt.in), keys)
+		close(keys)
+		var got []key
+		for k := range keys {
+			got = append(got, k)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
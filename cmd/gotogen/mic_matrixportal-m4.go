@@ -0,0 +1,232 @@
+//go:build matrixportal_m4
+
+package main
+
+import (
+	"encoding/base64"
+	"hash/crc32"
+	"io"
+	"machine"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ajanata/textbuf"
+
+	"github.com/ajanata/gotogen-hardware/internal/mic"
+)
+
+// talking cutoff presets; calibration can set any other value
+var talkCutoffs = [...]uint16{2000, 2500, 3000, 3500, 4000, 4500, 5000}
+
+const (
+	// how long to record the room, and then the wearer talking, for calibration
+	calibrateTime     = 3 * time.Second
+	calibrateInterval = 10 * time.Millisecond
+
+	recordFile = "/mic.wav"
+	recordTime = 5 * time.Second
+	// samples buffered between the interrupt and the flash; about 0.5s
+	recordRing = 8192
+)
+
+// talkCutoffOptions returns the menu options for the talking cutoff, and which one is active. A calibrated value that
+// isn't one of the presets is added to the end.
+func (d *driver) talkCutoffOptions() ([]string, uint8) {
+	cur := uint16(d.vad.MinLevel)
+	opts := make([]string, len(talkCutoffs), len(talkCutoffs)+1)
+	active := -1
+	for i, c := range talkCutoffs {
+		opts[i] = strconv.Itoa(int(c))
+		if c == cur {
+			active = i
+		}
+	}
+	if active < 0 {
+		opts = append(opts, strconv.Itoa(int(cur))+" (cal)")
+		active = len(opts) - 1
+	}
+	return opts, uint8(active)
+}
+
+func (d *driver) setTalkCutoff(s uint8) {
+	if int(s) >= len(talkCutoffs) {
+		// the calibrated value, which is already in effect
+		return
+	}
+	// a preset replaces calibration entirely, so go back to the default ratios too
+	def := mic.NewVAD()
+	d.vad.MinLevel = float32(talkCutoffs[s])
+	d.vad.Open, d.vad.Close = def.Open, def.Close
+	d.settings.VADOpen, d.settings.VADClose = 0, 0
+	d.saveSettings()
+}
+
+// calibrateMic records the room and then the wearer talking, and sets the talking thresholds from them.
+func (d *driver) calibrateMic() {
+	d.g.Busy(func(buf *textbuf.Buffer) {
+		buf.AutoFlush = true
+		_ = buf.Println("Stay quiet...")
+		time.Sleep(time.Second)
+		silence := d.recordLevels()
+		_ = buf.Println("Now talk until done...")
+		time.Sleep(time.Second)
+		speech := d.recordLevels()
+
+		cal, err := mic.Calibrate(silence, speech)
+		_ = buf.Println("Noise " + strconv.Itoa(int(cal.Noise)) + " talk " + strconv.Itoa(int(cal.Speech)))
+		if err != nil {
+			_ = buf.PrintlnInverse("Failed: " + err.Error())
+			return
+		}
+
+		cal.Apply(d.vad)
+		d.settings.VADOpen = uint8(cal.Open*10 + 0.5)
+		d.settings.VADClose = uint8(cal.Close*10 + 0.5)
+		d.saveSettings()
+		_ = buf.Println("Cutoff " + strconv.Itoa(int(cal.MinLevel)))
+		_ = buf.Println("Open x" + ratio(cal.Open) + " close x" + ratio(cal.Close))
+	})
+}
+
+// recordLevels samples the mic level for calibrateTime.
+func (d *driver) recordLevels() []float32 {
+	levels := make([]float32, 0, calibrateTime/calibrateInterval)
+	for len(levels) < cap(levels) {
+		time.Sleep(calibrateInterval)
+		levels = append(levels, d.mic.Value())
+	}
+	return levels
+}
+
+// recordMic saves a few seconds of raw mic samples to recordFile, for tuning on a computer.
+func (d *driver) recordMic() {
+	d.g.Busy(func(buf *textbuf.Buffer) {
+		buf.AutoFlush = true
+		if d.fs == nil {
+			_ = buf.PrintlnInverse("No filesystem, format flash first.")
+			return
+		}
+
+		f, err := d.fs.OpenFile(recordFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+		if err != nil {
+			_ = buf.PrintlnInverse("Record: " + err.Error())
+			return
+		}
+		n := int(float64(d.mic.SampleRate())*recordTime.Seconds() + 0.5)
+		err = d.writeRecording(f, n, buf)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = buf.PrintlnInverse("Record: " + err.Error())
+			return
+		}
+		if dropped := d.mic.Dropped(); dropped > 0 {
+			_ = buf.PrintlnInverse("Dropped " + strconv.Itoa(dropped) + " samples")
+		}
+		_ = buf.Println("Saved " + recordFile)
+	})
+}
+
+func (d *driver) writeRecording(f io.Writer, n int, buf *textbuf.Buffer) error {
+	w, err := mic.NewWAVWriter(f, d.mic.SampleRate(), n)
+	if err != nil {
+		return err
+	}
+
+	_ = buf.Println("Recording " + strconv.Itoa(int(recordTime/time.Second)) + "s...")
+	chunk := make([]uint16, 512)
+	d.mic.Record(n, make([]uint16, recordRing))
+	written := 0
+	for {
+		k, done := d.mic.ReadRecording(chunk)
+		if k > 0 {
+			if err := w.Write(chunk[:k]); err != nil {
+				d.mic.StopRecording()
+				return err
+			}
+			written += k
+		}
+		if done {
+			break
+		}
+		if k < len(chunk) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// samples dropped earlier were already replaced with silence in place, but those dropped at the very end weren't;
+	// pad them out, so the file is as long as the header says
+	for i := range chunk {
+		chunk[i] = 0x8000
+	}
+	for written < n {
+		k := n - written
+		if k > len(chunk) {
+			k = len(chunk)
+		}
+		if err := w.Write(chunk[:k]); err != nil {
+			return err
+		}
+		written += k
+	}
+	return nil
+}
+
+// sendRecording sends recordFile over the USB serial port, base64 encoded between BEGIN and END lines, for
+// cmd/micrec to receive. The END line has the length and CRC-32 of the file, so that it can tell if anything else was
+// written to the port in between.
+func (d *driver) sendRecording() {
+	d.g.Busy(func(buf *textbuf.Buffer) {
+		buf.AutoFlush = true
+		if d.fs == nil {
+			_ = buf.PrintlnInverse("No filesystem, format flash first.")
+			return
+		}
+		f, err := d.fs.Open(recordFile)
+		if err != nil {
+			_ = buf.PrintlnInverse("Send: " + err.Error())
+			return
+		}
+		defer f.Close()
+
+		_ = buf.Println("Sending " + recordFile + " over USB serial.")
+		// keep the background resync from logging in the middle of it
+		d.serialLock.Lock()
+		defer d.serialLock.Unlock()
+
+		_, _ = machine.Serial.Write([]byte("BEGIN " + recordFile + "\r\n"))
+		crc := crc32.NewIEEE()
+		size := 0
+		// 57 bytes encode to a 76 character line
+		raw := make([]byte, 57)
+		line := make([]byte, base64.StdEncoding.EncodedLen(len(raw))+2)
+		for {
+			k, err := io.ReadFull(f, raw)
+			if k > 0 {
+				_, _ = crc.Write(raw[:k])
+				size += k
+				e := base64.StdEncoding.EncodedLen(k)
+				base64.StdEncoding.Encode(line, raw[:k])
+				line[e], line[e+1] = '\r', '\n'
+				_, _ = machine.Serial.Write(line[:e+2])
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				_, _ = machine.Serial.Write([]byte("ERROR " + err.Error() + "\r\n"))
+				_ = buf.PrintlnInverse("Send: " + err.Error())
+				return
+			}
+		}
+		sum := strconv.FormatUint(uint64(crc.Sum32()), 16)
+		_, _ = machine.Serial.Write([]byte("END " + strconv.Itoa(size) + " " + sum + "\r\n"))
+		_ = buf.Println("Sent.")
+	})
+}
+
+func ratio(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 1, 32)
+}
@@ -0,0 +1,159 @@
+//go:build matrixportal_m4
+
+package main
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/ajanata/textbuf"
+
+	"github.com/ajanata/gotogen-hardware/internal/drift"
+	"github.com/ajanata/gotogen-hardware/internal/ntp"
+)
+
+// the offset register isn't exposed by the pcf8523 driver
+const (
+	pcf8523Address   = 0x68
+	pcf8523RegOffset = 0x0E
+)
+
+var errRTCStopped = errors.New("rtc not ticking")
+
+// syncTime brings up Wi-Fi, queries the NTP servers, and adjusts the local clock by the result. It does not set the RTC.
+// Progress is reported on buf, which may be nil.
+func (d *driver) syncTime(buf *textbuf.Buffer) (ntp.Result, error) {
+	d.timeLock.Lock()
+	defer d.timeLock.Unlock()
+
+	// don't bother bringing up Wi-Fi if every server has told us to go away
+	if err := ntp.CheckBackoff(ntpServers); err != nil {
+		return ntp.Result{}, err
+	}
+
+	if buf != nil {
+		_ = buf.Println("Wifi: connecting")
+	}
+	err := d.link.Connect()
+	if err != nil {
+		return ntp.Result{}, err
+	}
+	defer d.link.Disconnect()
+	if buf != nil {
+		_ = buf.Println("Joined " + d.link.SSID())
+	}
+
+	ip, err := d.link.Addr()
+	if err != nil {
+		return ntp.Result{}, err
+	}
+	if buf != nil {
+		_ = buf.Println("DHCP: " + ip.String())
+	}
+
+	res, err := ntp.Sync(net.Dial, ntpServers, ntpSamples, buf)
+	if err != nil {
+		return ntp.Result{}, err
+	}
+	runtime.AdjustTimeOffset(int64(res.Offset))
+	return res, nil
+}
+
+// setRTC sets the RTC to the local time, and starts a new drift measurement. It waits for the start of the next second
+// first, since the RTC can only be set to a whole second. rtcLock must be held.
+func (d *driver) setRTC() error {
+	now := time.Now()
+	time.Sleep(now.Truncate(time.Second).Add(time.Second).Sub(now))
+
+	d.waitForDMA()
+	now = time.Now()
+	err := d.rtc.SetTime(now.Round(time.Second).In(time.UTC))
+	if err != nil {
+		return err
+	}
+	d.drift.Start(now)
+	return nil
+}
+
+// readRTCEdge waits for the RTC's seconds to tick over, and returns its reading along with the local time at which it
+// was taken. This gets much better than the RTC's one-second resolution. rtcLock must be held.
+func (d *driver) readRTCEdge() (rtc time.Time, now time.Time, err error) {
+	d.waitForDMA()
+	first, err := d.rtc.ReadTime()
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	deadline := time.Now().Add(1100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+		d.waitForDMA()
+		rtc, err = d.rtc.ReadTime()
+		now = time.Now()
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if !rtc.Equal(first) {
+			return rtc, now, nil
+		}
+	}
+	return time.Time{}, time.Time{}, errRTCStopped
+}
+
+// setRTCOffset programs the PCF8523 offset register, correcting every two hours. rtcLock must be held.
+func (d *driver) setRTCOffset(v int8) error {
+	d.waitForDMA()
+	err := d.bus.WriteRegister(pcf8523Address, pcf8523RegOffset, []byte{byte(v) & 0x7F})
+	if err != nil {
+		return err
+	}
+	d.rtcOffset = v
+	return nil
+}
+
+// resyncLoop periodically re-syncs the time from NTP, for as long as the device runs.
+func (d *driver) resyncLoop() {
+	for {
+		time.Sleep(resyncInterval)
+		d.resync()
+	}
+}
+
+// resync sets the local clock from NTP, measures how far the RTC drifted since it was last set, corrects the RTC's
+// offset register for it, then sets the RTC.
+func (d *driver) resync() {
+	d.serialLock.Lock()
+	defer d.serialLock.Unlock()
+
+	res, err := d.syncTime(nil)
+	if err != nil {
+		println("resync ntp:", err.Error())
+		return
+	}
+	println("resync offset", res.Offset.String(), "delay", res.Delay.String())
+
+	d.rtcLock.Lock()
+	defer d.rtcLock.Unlock()
+	rtc, now, err := d.readRTCEdge()
+	if err != nil {
+		println("resync reading rtc:", err.Error())
+		return
+	}
+	if ppm, ok := d.drift.Observe(rtc, now); ok {
+		v := drift.PCF8523Offset(d.rtcOffset, ppm)
+		println("rtc drift", int(ppm*1000), "ppb, offset register", d.rtcOffset, "->", v)
+		err := d.setRTCOffset(v)
+		if err != nil {
+			println("resync setting rtc offset:", err.Error())
+		} else {
+			d.saveSettings()
+		}
+	}
+
+	err = d.setRTC()
+	if err != nil {
+		println("resync setting rtc:", err.Error())
+	}
+}
@@ -0,0 +1,247 @@
+//go:build sim
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/input"
+)
+
+// A trace scripts the simulator's inputs, for repeatable runs. Each line is a time since start, an event and its
+// arguments; blank lines and everything after # are ignored. Events must be in order.
+//
+//	0s     mic 300          # mic level, like Mic.Value
+//	500ms  tap down         # press and release a button: up, down, back, menu, mic or touch
+//	1s     press menu       # hold a button...
+//	1.2s   release menu     # ...and let go
+//	1.5s   touch 0 3        # hold touch electrodes; touch with no electrodes lets go
+//	2s     accel 0 0 1000   # accelerometer, in milli-g
+//	2.5s   snap menu-open   # save or compare both displays, see -golden
+//
+// A tap holds the button down for simTapTime, so taps of the same button must be further apart than that to count
+// twice. The simulator quits after the last event.
+type traceEvent struct {
+	line int
+	at   time.Duration
+	kind string
+	args []string
+}
+
+var traceButtons = map[string]byte{
+	"up":    1 << input.Up,
+	"down":  1 << input.Down,
+	"back":  1 << input.Back,
+	"menu":  1 << input.Menu,
+	"mic":   1 << input.ToggleMic,
+	"touch": 1 << input.ToggleTouch,
+}
+
+// number of MPR121 electrodes
+const touchElectrodes = 12
+
+func loadTrace(name string) ([]traceEvent, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []traceEvent
+	s := bufio.NewScanner(f)
+	line := 0
+	for s.Scan() {
+		line++
+		text, _, _ := strings.Cut(s.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected time and event", name, line)
+		}
+		at, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		if len(events) > 0 && at < events[len(events)-1].at {
+			return nil, fmt.Errorf("%s:%d: out of order", name, line)
+		}
+		ev := traceEvent{line: line, at: at, kind: fields[1], args: fields[2:]}
+		if err := ev.check(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		events = append(events, ev)
+	}
+	return events, s.Err()
+}
+
+// check validates the event's arguments, so that mistakes are found before the simulator starts.
+func (ev traceEvent) check() error {
+	switch ev.kind {
+	case "tap", "press", "release":
+		if len(ev.args) != 1 || traceButtons[ev.args[0]] == 0 {
+			return errors.New(ev.kind + " needs one of up, down, back, menu, mic or touch")
+		}
+	case "touch":
+		_, err := ev.electrodes()
+		return err
+	case "accel":
+		_, err := ev.ints(3)
+		return err
+	case "mic":
+		_, err := ev.ints(1)
+		return err
+	case "snap":
+		if len(ev.args) > 1 {
+			return errors.New("snap takes at most a name")
+		}
+	default:
+		return errors.New("unknown event " + ev.kind)
+	}
+	return nil
+}
+
+func (ev traceEvent) ints(n int) ([]int32, error) {
+	if len(ev.args) != n {
+		return nil, fmt.Errorf("%s needs %d numbers", ev.kind, n)
+	}
+	v := make([]int32, n)
+	for i, a := range ev.args {
+		x, err := strconv.ParseInt(a, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = int32(x)
+	}
+	return v, nil
+}
+
+func (ev traceEvent) electrodes() (uint16, error) {
+	var e uint16
+	for _, a := range ev.args {
+		n, err := strconv.Atoi(a)
+		if err != nil || n < 0 || n >= touchElectrodes {
+			return 0, errors.New("bad electrode " + a)
+		}
+		e |= 1 << n
+	}
+	return e, nil
+}
+
+// player feeds a trace to the driver as time passes.
+type player struct {
+	events []traceEvent
+	start  time.Time
+	next   int
+
+	golden string
+	update bool
+	snaps  int
+	failed bool
+}
+
+// play applies the events that are due.
+func (p *player) play(d *driver, now time.Time) {
+	if p.start.IsZero() {
+		p.start = now
+	}
+	for ; p.next < len(p.events) && now.Sub(p.start) >= p.events[p.next].at; p.next++ {
+		ev := p.events[p.next]
+		switch ev.kind {
+		case "tap":
+			d.tap(traceButtons[ev.args[0]], now)
+		case "press":
+			d.held |= traceButtons[ev.args[0]]
+		case "release":
+			d.held &^= traceButtons[ev.args[0]]
+		case "touch":
+			d.touched, _ = ev.electrodes()
+		case "accel":
+			v, _ := ev.ints(3)
+			copy(d.accel[:], v)
+		case "mic":
+			v, _ := ev.ints(1)
+			d.micLevel = float32(v[0])
+		case "snap":
+			p.snap(ev, d.faceDisp, d.menuDisp)
+		}
+	}
+	if p.next == len(p.events) {
+		if p.failed {
+			d.exit(1)
+		}
+		d.quit()
+	}
+}
+
+// snap saves the displays as golden images with -update, or otherwise compares them to the saved ones. A mismatch
+// saves what was actually drawn alongside, and makes the simulator exit with an error at the end of the trace.
+func (p *player) snap(ev traceEvent, displays ...*simDisplay) {
+	p.snaps++
+	name := fmt.Sprintf("snap%02d", p.snaps)
+	if len(ev.args) > 0 {
+		name = ev.args[0]
+	}
+	if p.golden == "" {
+		return
+	}
+
+	for _, d := range displays {
+		file := filepath.Join(p.golden, name+"-"+d.name+".png")
+		img := d.current()
+		if p.update {
+			if err := writePNG(file, img); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				p.failed = true
+			}
+			continue
+		}
+
+		if msg := compareGolden(file, img); msg != "" {
+			fmt.Fprintf(os.Stderr, "line %d: %s %s: %s\n", ev.line, name, d.name, msg)
+			p.failed = true
+			_ = writePNG(strings.TrimSuffix(file, ".png")+".got.png", img)
+		}
+	}
+}
+
+// compareGolden returns why img doesn't match the golden image in file, or "" if it does.
+func compareGolden(file string, img *image.RGBA) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err.Error()
+	}
+	want, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err.Error()
+	}
+	if want.Bounds() != img.Bounds() {
+		return "size differs"
+	}
+	diff := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r1, g1, b1, _ := want.At(x, y).RGBA()
+			r2, g2, b2, _ := img.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		return strconv.Itoa(diff) + " pixels differ"
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+//go:build sim
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajanata/gotogen"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// as in main
+const testFPS = 60
+
+var menuButtonNames = map[gotogen.MenuButton]string{
+	gotogen.MenuButtonMenu: "menu",
+	gotogen.MenuButtonBack: "back",
+	gotogen.MenuButtonUp:   "up",
+	gotogen.MenuButtonDown: "down",
+}
+
+// TestTraces plays back each trace in testdata on the virtual clock, polling the driver once per frame like gotogen,
+// and compares the menu buttons it returned and every change in its sensors and status line to the golden file.
+func TestTraces(t *testing.T) {
+	traces, err := filepath.Glob("testdata/*.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) == 0 {
+		t.Fatal("no traces in testdata")
+	}
+	for _, file := range traces {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			got, err := playTrace(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := strings.TrimSuffix(file, ".trace") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s differs from %s; run with -update if that's expected:\n%s", file, golden,
+					firstDiff(got, string(want)))
+			}
+		})
+	}
+}
+
+// TestTraceFrames plays back each trace in testdata through gotogen itself, and compares both displays at the trace's
+// snap events to the PNGs in the directory named after the trace; -update rewrites them. A mismatch leaves what was
+// drawn beside the golden image as .got.png.
+func TestTraceFrames(t *testing.T) {
+	traces, err := filepath.Glob("testdata/*.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range traces {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			events, err := loadTrace(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := strings.TrimSuffix(file, ".trace")
+			if *update {
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d, err := newDriver()
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.play(events, testFPS, dir, *update)
+			status := make(chan int, 1)
+			d.exit = func(code int) {
+				status <- code
+				// Run never returns
+				runtime.Goexit()
+			}
+
+			// The virtual clock advances a frame each time gotogen polls, so it can draw as fast as it likes.
+			g, err := gotogen.New(1000, d.menuDisp, blinker{}, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.g = g
+			if err := g.Init(); err != nil {
+				t.Fatal(err)
+			}
+			go g.Run()
+
+			select {
+			case code := <-status:
+				if code != 0 {
+					t.Errorf("%s: frames differ from %s; run with -update if that's expected", file, dir)
+				}
+			case <-time.After(time.Minute):
+				t.Fatalf("%s: still running after a minute", file)
+			}
+		})
+	}
+}
+
+// playTrace plays the trace in file through a new driver, and returns a log of what it told gotogen.
+func playTrace(file string) (string, error) {
+	events, err := loadTrace(file)
+	if err != nil {
+		return "", err
+	}
+	d, err := newDriver()
+	if err != nil {
+		return "", err
+	}
+	d.play(events, testFPS, "", false)
+	done := false
+	d.exit = func(code int) {
+		done = true
+		if code != 0 {
+			err = fmt.Errorf("exit status %d", code)
+		}
+	}
+
+	var log strings.Builder
+	last := ""
+	// well past the end of the trace, in case it never finishes
+	limit := int((events[len(events)-1].at + time.Second) * testFPS / time.Second)
+	for frame := 0; !done; frame++ {
+		if frame > limit {
+			return "", fmt.Errorf("still running after %d frames", frame)
+		}
+		b := d.PressedButton()
+		at := d.clock.Sub(simEpoch).Round(time.Millisecond)
+		if b != gotogen.MenuButtonNone {
+			fmt.Fprintf(&log, "%-8v %s\n", at, menuButtonNames[b])
+		}
+		x, y, z, _ := d.Accelerometer()
+		state := fmt.Sprintf("talking=%v open=%d accel=%d,%d,%d %q", d.Talking(), d.MouthOpenness(), x, y, z,
+			d.StatusLine())
+		if state != last {
+			fmt.Fprintf(&log, "%-8v %s\n", at, state)
+			last = state
+		}
+	}
+	return log.String(), err
+}
+
+// firstDiff returns the first line where got and want differ.
+func firstDiff(got, want string) string {
+	g, w := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; i < len(g) || i < len(w); i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl {
+			return fmt.Sprintf("line %d:\n got: %s\nwant: %s", i+1, gl, wl)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,235 @@
+// Command micrec pulls mic recordings off the badge, and analyses them for tuning talk detection. It runs on the host,
+// not the badge.
+//
+// To make a recording, use "Mic recording" > "Record" in the badge's menu. Then run
+//
+//	micrec pull -o mic.wav /dev/ttyACM0
+//
+// and choose "Send over USB serial" on the badge. The recording is saved as a normal WAV file, which any audio player
+// can play, and analysed. To analyse a recording again, perhaps with different settings:
+//
+//	micrec analyse -min 2500 mic.wav
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/mic"
+)
+
+// analysis settings, shared by both subcommands
+var (
+	window   time.Duration
+	highPass float64
+	minLevel float64
+	plot     bool
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "pull":
+		fs := analysisFlags("pull")
+		out := fs.String("o", "mic.wav", "file to save the recording to")
+		_ = fs.Parse(os.Args[2:])
+		if fs.NArg() != 1 {
+			usage()
+		}
+		err = pull(fs.Arg(0), *out)
+		if err == nil {
+			fmt.Println("saved", *out)
+			err = analyse(*out)
+		}
+	case "analyse", "analyze":
+		fs := analysisFlags("analyse")
+		_ = fs.Parse(os.Args[2:])
+		if fs.NArg() != 1 {
+			usage()
+		}
+		err = analyse(fs.Arg(0))
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: micrec pull [flags] <serial port>")
+	fmt.Fprintln(os.Stderr, "       micrec analyse [flags] <file.wav>")
+	os.Exit(2)
+}
+
+func analysisFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.DurationVar(&window, "window", 16*time.Millisecond, "mic window")
+	fs.Float64Var(&highPass, "highpass", 150, "high-pass filter cutoff in Hz, or 0 for none")
+	fs.Float64Var(&minLevel, "min", 3000, "VAD minimum level, like the talking cutoff setting")
+	fs.BoolVar(&plot, "plot", false, "plot the level every 100ms")
+	return fs
+}
+
+// pull waits for the badge to send a recording over the serial port, and saves it.
+func pull(port, out string) error {
+	f, err := os.Open(port)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Println("waiting; choose \"Send over USB serial\" on the badge")
+	data, err := receive(f)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, data, 0o644)
+}
+
+// receive reads what the badge sends over the serial port, up to the end of the recording, and returns the recording.
+// Anything before the BEGIN line is the badge's debug output, and ignored.
+func receive(r io.Reader) ([]byte, error) {
+	s := bufio.NewScanner(r)
+	started := false
+	var data []byte
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case strings.HasPrefix(line, "BEGIN "):
+			started = true
+			data = data[:0]
+		case !started:
+			// debug output from the badge
+		case line == "END" || strings.HasPrefix(line, "END "):
+			if err := checkEnd(line, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		case strings.HasPrefix(line, "ERROR "):
+			return nil, errors.New("badge: " + line[len("ERROR "):])
+		default:
+			b, err := base64.StdEncoding.DecodeString(line)
+			if err != nil {
+				return nil, fmt.Errorf("garbled line %q: %w", line, err)
+			}
+			data = append(data, b...)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// checkEnd compares the length and CRC-32 on the END line with what was received.
+func checkEnd(line string, data []byte) error {
+	f := strings.Fields(line)
+	if len(f) != 3 {
+		return fmt.Errorf("bad END line %q", line)
+	}
+	size, err := strconv.Atoi(f[1])
+	if err != nil {
+		return fmt.Errorf("bad END line %q", line)
+	}
+	sum, err := strconv.ParseUint(f[2], 16, 32)
+	if err != nil {
+		return fmt.Errorf("bad END line %q", line)
+	}
+	if len(data) != size || crc32.ChecksumIEEE(data) != uint32(sum) {
+		return fmt.Errorf("received %d bytes with CRC %x, but the badge sent %d with CRC %x", len(data),
+			crc32.ChecksumIEEE(data), size, sum)
+	}
+	return nil
+}
+
+// analyse plays back a recording through the same processing as the badge, and summarizes what it heard.
+func analyse(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	src, err := mic.ReadWAV(f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	rate := src.SampleRate()
+	fmt.Printf("%d samples at %.0f Hz, %s\n", len(src.Samples), rate,
+		time.Duration(float64(len(src.Samples))/float64(rate)*float64(time.Second)).Round(time.Millisecond))
+
+	var sum uint64
+	clipped := 0
+	for _, v := range src.Samples {
+		sum += uint64(v)
+		// the ADC's 12 bits are scaled to 16, so full scale is 0xFFF0
+		if v == 0 || v >= 0xFFF0 {
+			clipped++
+		}
+	}
+	if len(src.Samples) > 0 {
+		fmt.Printf("DC offset %.0f, %d samples clipped\n", float64(sum)/float64(len(src.Samples))-0x8000, clipped)
+	}
+
+	m := mic.New(src, window)
+	m.SetHighPass(float32(highPass))
+	vad := mic.NewVAD()
+	vad.MinLevel = float32(minLevel)
+
+	// like the badge, update every few milliseconds
+	const frame = 10 * time.Millisecond
+	step := int(float64(rate)*frame.Seconds() + 0.5)
+	var levels []float32
+	talking := 0
+	now := time.Unix(0, 0)
+	for src.Advance(step) == step {
+		now = now.Add(frame)
+		level := m.Value()
+		levels = append(levels, level)
+		t := vad.Update(level, now)
+		if t {
+			talking++
+		}
+		if plot && len(levels)%10 == 0 {
+			mark := ' '
+			if t {
+				mark = '*'
+			}
+			fmt.Printf("%6.1fs %c %6.0f %s\n", now.Sub(time.Unix(0, 0)).Seconds(), mark, level, bar(level))
+		}
+	}
+	if len(levels) == 0 {
+		return errors.New("recording too short")
+	}
+
+	sorted := append([]float32(nil), levels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	pct := func(p int) float32 { return sorted[(len(sorted)-1)*p/100] }
+	fmt.Printf("level p5 %.0f, p50 %.0f, p95 %.0f, max %.0f\n", pct(5), pct(50), pct(95), sorted[len(sorted)-1])
+	fmt.Printf("talking %.0f%% of the time, noise floor ended at %.0f\n", 100*float64(talking)/float64(len(levels)), vad.Floor())
+	return nil
+}
+
+// bar draws level on a log scale, up to about the loudest the mic can go.
+func bar(level float32) string {
+	n := 0
+	for l := level; l >= 100 && n < 60; l /= 1.1 {
+		n++
+	}
+	return strings.Repeat("#", n)
+}
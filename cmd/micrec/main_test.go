@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// end returns the END line the badge sends for data.
+func end(data []byte) string {
+	return "END " + strconv.Itoa(len(data)) + " " + strconv.FormatUint(uint64(crc32.ChecksumIEEE(data)), 16)
+}
+
+func TestCheckEnd(t *testing.T) {
+	data := []byte("RIFF....WAVE")
+	tests := []struct {
+		name string
+		line string
+		ok   bool
+	}{
+		{"good", end(data), true},
+		{"bare", "END", false},
+		{"no CRC", "END 12", false},
+		{"extra", end(data) + " 1", false},
+		{"bad length", "END twelve " + strconv.FormatUint(uint64(crc32.ChecksumIEEE(data)), 16), false},
+		{"bad CRC", "END 12 xyz", false},
+		{"short", end(data[:11]), false},
+		{"wrong CRC", "END 12 0", false},
+	}
+	for _, tt := range tests {
+		if err := checkEnd(tt.line, data); (err == nil) != tt.ok {
+			t.Errorf("%s: %q: got %v, want ok %v", tt.name, tt.line, err, tt.ok)
+		}
+	}
+	if err := checkEnd(end(nil), nil); err != nil {
+		t.Errorf("empty: %v", err)
+	}
+}
+
+// send returns what the badge writes to the serial port to send data, 57 bytes to a line.
+func send(data []byte) string {
+	var b strings.Builder
+	b.WriteString("BEGIN /mic.wav\r\n")
+	for p := data; len(p) > 0; {
+		n := len(p)
+		if n > 57 {
+			n = 57
+		}
+		b.WriteString(base64.StdEncoding.EncodeToString(p[:n]) + "\r\n")
+		p = p[n:]
+	}
+	b.WriteString(end(data) + "\r\n")
+	return b.String()
+}
+
+func TestReceive(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	good := send(data)
+	lines := strings.SplitAfter(good, "\r\n")
+
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{"clean", good, nil},
+		{"debug output first", "resync offset 1ms\r\ngarbage that isn't base64!\r\n" + good, nil},
+		// a BEGIN starts over, in case an earlier send was cut off
+		{"restarted", strings.Join(lines[:4], "") + good, nil},
+		{"cut off", strings.Join(lines[:4], ""), io.ErrUnexpectedEOF},
+		{"nothing", "", io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		got, err := receive(strings.NewReader(tt.in))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && !bytes.Equal(got, data) {
+			t.Errorf("%s: received %d bytes that differ from the %d sent", tt.name, len(got), len(data))
+		}
+	}
+}
+
+func TestReceiveErrors(t *testing.T) {
+	data := []byte("a recording of some length, long enough for two lines of base64 when it's sent over the port")
+	good := send(data)
+	lines := strings.SplitAfter(good, "\r\n")
+
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"badge error", "BEGIN /mic.wav\r\nERROR read failed\r\n"},
+		// a log line from the badge in the middle of the data
+		{"interleaved", lines[0] + lines[1] + "resync ntp: timeout\r\n" + strings.Join(lines[2:], "")},
+		// a line lost entirely still decodes, but the END line doesn't match
+		{"lost line", lines[0] + lines[1] + strings.Join(lines[3:], "")},
+		{"bare END", lines[0] + lines[1] + lines[2] + "END\r\n"},
+	}
+	for _, tt := range tests {
+		if _, err := receive(strings.NewReader(tt.in)); err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v, want an error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Command visemes runs the mic's talk detection and viseme classifier over labelled recordings, and reports how often
+// they got it right. It runs on the host, not the badge.
+//
+// Each recording must be a WAV file in a directory named for its viseme: closed, a, e, o or ss. For example:
+//
+//	visemes clips/a/*.wav clips/ss/*.wav
+//
+// Recordings are played back frame by frame, as the badge would hear them. For closed clips every frame is expected to
+// be classified as closed; for the others, only frames where the wearer is detected talking are scored, since
+// recordings of speech have gaps.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/mic"
+)
+
+var visemes = []mic.Viseme{mic.VisemeClosed, mic.VisemeA, mic.VisemeE, mic.VisemeO, mic.VisemeSS}
+
+func main() {
+	window := flag.Duration("window", 16*time.Millisecond, "mic window")
+	frame := flag.Duration("frame", 20*time.Millisecond, "time between classifications, like the face's frame rate")
+	minLevel := flag.Float64("min", 3000, "VAD minimum level, like the talking cutoff setting")
+	highPass := flag.Float64("highpass", 150, "high-pass filter cutoff in Hz, or 0 for none")
+	verbose := flag.Bool("v", false, "print every frame")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: visemes [flags] <label>/clip.wav...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// confusion[label][guess]
+	confusion := make(map[mic.Viseme]map[mic.Viseme]int)
+	for _, name := range flag.Args() {
+		label, ok := parseLabel(filepath.Base(filepath.Dir(name)))
+		if !ok {
+			fmt.Fprintln(os.Stderr, name+": directory isn't a viseme")
+			os.Exit(1)
+		}
+		guesses, err := run(name, label, *window, *frame, float32(*minLevel), float32(*highPass), *verbose)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, name+":", err)
+			os.Exit(1)
+		}
+		if confusion[label] == nil {
+			confusion[label] = make(map[mic.Viseme]int)
+		}
+		for v, n := range guesses {
+			confusion[label][v] += n
+		}
+	}
+
+	report(confusion)
+}
+
+// run plays back one clip, and counts the scored frames by what they were classified as.
+func run(name string, label mic.Viseme, window, frame time.Duration, minLevel, highPass float32, verbose bool) (map[mic.Viseme]int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	src, err := mic.ReadWAV(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	m := mic.New(src, window)
+	m.SetHighPass(highPass)
+	vad := mic.NewVAD()
+	vad.MinLevel = minLevel
+	cl := mic.NewClassifier(src.SampleRate())
+	samples := make([]uint16, int(float64(src.SampleRate())*window.Seconds()+0.5))
+	step := int(float64(src.SampleRate())*frame.Seconds() + 0.5)
+
+	guesses := make(map[mic.Viseme]int)
+	now := time.Unix(0, 0)
+	for src.Advance(step) == step {
+		now = now.Add(frame)
+		talking := vad.Update(m.Value(), now)
+		v, conf := mic.VisemeClosed, float32(1)
+		if talking {
+			n := m.Snapshot(samples)
+			v, conf = cl.Classify(samples[:n])
+		}
+		if verbose {
+			fmt.Printf("%s %6s level %5.0f floor %5.0f %-6s %.2f\n", name, now.Sub(time.Unix(0, 0)), m.Value(), vad.Floor(), v, conf)
+		}
+		if talking || label == mic.VisemeClosed {
+			guesses[v]++
+		}
+	}
+	return guesses, nil
+}
+
+func report(confusion map[mic.Viseme]map[mic.Viseme]int) {
+	fmt.Printf("%-8s", "label")
+	for _, v := range visemes {
+		fmt.Printf("%8s", v)
+	}
+	fmt.Printf("%10s\n", "accuracy")
+
+	var right, total int
+	for _, label := range visemes {
+		row := confusion[label]
+		if row == nil {
+			continue
+		}
+		var n int
+		fmt.Printf("%-8s", label)
+		for _, v := range visemes {
+			fmt.Printf("%8d", row[v])
+			n += row[v]
+		}
+		right += row[label]
+		total += n
+		fmt.Printf("%9.1f%%\n", percent(row[label], n))
+	}
+	fmt.Printf("overall %.1f%% of %d frames\n", percent(right, total), total)
+}
+
+func parseLabel(s string) (mic.Viseme, bool) {
+	for _, v := range visemes {
+		if strings.EqualFold(s, v.String()) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func percent(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(of)
+}
@@ -0,0 +1,296 @@
+// Package config reads the per-device configuration file, so that one firmware image works for everyone.
+//
+// The file is a small subset of TOML:
+//
+//	# comments start with a hash
+//	timezone = "PST8PDT,M3.2.0,M11.1.0"
+//	ntp = ["time.nist.gov:123", "pool.ntp.org:123"]
+//	resync = "6h"
+//
+//	[[network]]
+//	ssid = "home"
+//	password = "hunter2"
+//	priority = 10
+//
+//	[[network]]
+//	ssid = "workshop"
+//	password = "correct horse battery staple"
+//	auth = "wpa2-mixed"
+//
+//	[[network]]
+//	ssid = "convention free wifi"
+//	priority = -1
+//
+//	[[network]]
+//	ssid = "badge lab"
+//	password = "swordfish"
+//	hidden = true
+//
+// Keys outside of a [[network]] table are device-wide. Networks with a higher priority are preferred. A network's auth
+// is one of open, wpa, wpa2, wpa2-mixed or wpa3; it defaults to wpa2, or open if there is no password. Whether each
+// one works depends on the network device. A hidden network doesn't show up in a scan, so it is tried regardless.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/wifi"
+)
+
+// Config is the contents of the configuration file. Zero values mean the setting wasn't present.
+type Config struct {
+	// Networks are sorted by descending priority.
+	Networks       []wifi.Network
+	TimeZone       string
+	NTPServers     []string
+	ResyncInterval time.Duration
+}
+
+// SyntaxError describes a problem with a line in the configuration file.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Msg
+}
+
+// Parse reads a configuration file from r.
+func Parse(r io.Reader) (*Config, error) {
+	c := &Config{}
+	var nw *wifi.Network
+	// line each network's table started on, for errors, and whether it set auth
+	var netLines []int
+	var netAuth []bool
+
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		if text[0] == '[' {
+			if text != "[[network]]" {
+				return nil, &SyntaxError{line, "unknown table " + text}
+			}
+			c.Networks = append(c.Networks, wifi.Network{})
+			nw = &c.Networks[len(c.Networks)-1]
+			netLines = append(netLines, line)
+			netAuth = append(netAuth, false)
+			continue
+		}
+
+		key, val, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, &SyntaxError{line, "expected key = value"}
+		}
+		key = strings.TrimSpace(key)
+		v, err := parseValue(strings.TrimSpace(val))
+		if err != nil {
+			return nil, &SyntaxError{line, err.Error()}
+		}
+
+		if nw != nil {
+			err = setNetwork(nw, key, v)
+			if key == "auth" {
+				netAuth[len(netAuth)-1] = true
+			}
+		} else {
+			err = c.set(key, v)
+		}
+		if err != nil {
+			return nil, &SyntaxError{line, err.Error()}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range c.Networks {
+		n := &c.Networks[i]
+		if n.SSID == "" {
+			return nil, &SyntaxError{netLines[i], "network has no ssid"}
+		}
+		if !netAuth[i] && n.Password == "" {
+			n.Auth = wifi.AuthOpen
+		}
+	}
+	sort.SliceStable(c.Networks, func(i, j int) bool {
+		return c.Networks[i].Priority > c.Networks[j].Priority
+	})
+	return c, nil
+}
+
+func (c *Config) set(key string, v any) error {
+	var err error
+	switch key {
+	case "timezone":
+		c.TimeZone, err = asString(v)
+	case "ntp":
+		c.NTPServers, err = asList(v)
+	case "resync":
+		var s string
+		if s, err = asString(v); err == nil {
+			c.ResyncInterval, err = time.ParseDuration(s)
+		}
+	default:
+		err = errors.New("unknown key " + key)
+	}
+	return err
+}
+
+func setNetwork(n *wifi.Network, key string, v any) error {
+	var err error
+	switch key {
+	case "ssid":
+		n.SSID, err = asString(v)
+	case "password":
+		n.Password, err = asString(v)
+	case "priority":
+		n.Priority, err = asInt(v)
+	case "hidden":
+		n.Hidden, err = asBool(v)
+	case "auth":
+		var s string
+		if s, err = asString(v); err == nil {
+			n.Auth, err = wifi.ParseAuth(s)
+		}
+	default:
+		err = errors.New("unknown network key " + key)
+	}
+	return err
+}
+
+// parseValue parses a quoted string, an integer, a boolean, or an array of quoted strings. The result is a string, int,
+// bool, or []string respectively.
+func parseValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, errors.New("missing value")
+	case s[0] == '"':
+		v, rest, err := parseString(s)
+		if err != nil {
+			return nil, err
+		}
+		if !isComment(rest) {
+			return nil, errors.New("unexpected " + rest)
+		}
+		return v, nil
+	case s[0] == '[':
+		var list []string
+		rest := strings.TrimSpace(s[1:])
+		for len(rest) > 0 && rest[0] != ']' {
+			v, r, err := parseString(rest)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			rest = strings.TrimSpace(r)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, errors.New("expected , or ]")
+			}
+		}
+		if len(rest) == 0 || !isComment(rest[1:]) {
+			return nil, errors.New("unterminated array")
+		}
+		return list, nil
+	default:
+		num, _, _ := strings.Cut(s, "#")
+		switch num = strings.TrimSpace(num); num {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, errors.New("bad value " + s)
+		}
+		return n, nil
+	}
+}
+
+// parseString parses a double-quoted string at the start of s, with \\, \", \n and \t escapes. It returns the string
+// and whatever follows the closing quote.
+func parseString(s string) (string, string, error) {
+	if len(s) == 0 || s[0] != '"' {
+		return "", "", errors.New("expected string")
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			default:
+				return "", "", errors.New("bad escape \\" + string(s[i]))
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+// isComment reports whether s is empty or only a trailing comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+func asString(v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("expected string")
+	}
+	return s, nil
+}
+
+func asInt(v any) (int, error) {
+	n, ok := v.(int)
+	if !ok {
+		return 0, errors.New("expected number")
+	}
+	return n, nil
+}
+
+func asBool(v any) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, errors.New("expected true or false")
+	}
+	return b, nil
+}
+
+func asList(v any) ([]string, error) {
+	switch v := v.(type) {
+	case []string:
+		return v, nil
+	case string:
+		return []string{v}, nil
+	}
+	return nil, errors.New("expected list of strings")
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/wifi"
+)
+
+func TestParseNetworks(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(`
+[[network]]
+ssid = "home"
+password = "hunter2"
+priority = 10
+
+[[network]]
+ssid = "badge lab"
+password = "swordfish"
+hidden = true # not broadcast
+
+[[network]]
+ssid = "con"
+hidden = false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []wifi.Network{
+		{SSID: "home", Password: "hunter2", Priority: 10},
+		{SSID: "badge lab", Password: "swordfish", Hidden: true},
+		{SSID: "con", Auth: wifi.AuthOpen},
+	}
+	if !reflect.DeepEqual(cfg.Networks, want) {
+		t.Errorf("got %+v, want %+v", cfg.Networks, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"[[network]]\nssid = \"x\"\nhidden = 1\n",
+		"[[network]]\nssid = \"x\"\nhidden = \"true\"\n",
+		"[[network]]\nssid = \"x\"\npriority = true\n",
+		"timezone = false\n",
+	} {
+		if _, err := Parse(strings.NewReader(s)); err == nil {
+			t.Errorf("Parse(%q): no error", s)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(`
+[[network]]
+ssid = "low"
+priority = -1
+
+[[network]]
+ssid = "first tie"
+
+[[network]]
+ssid = "high"
+priority = 10
+
+[[network]]
+ssid = "second tie"
+priority = 0
+
+[[network]]
+ssid = "middle"
+priority = 5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range cfg.Networks {
+		got = append(got, n.SSID)
+	}
+	// highest first, and ties in the order they're in the file
+	want := []string{"high", "middle", "first tie", "second tie", "low"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(`
+[[network]]
+ssid = "open by default"
+
+[[network]]
+ssid = "wpa2 by default"
+password = "x"
+
+[[network]]
+ssid = "explicit without password"
+auth = "wpa3"
+
+[[network]]
+ssid = "explicit open with password"
+password = "x"
+auth = "open"
+
+[[network]]
+ssid = "mixed"
+password = "x"
+auth = "wpa2-mixed"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []wifi.Auth{wifi.AuthOpen, wifi.AuthWPA2, wifi.AuthWPA3, wifi.AuthOpen, wifi.AuthWPA2Mixed}
+	for i, n := range cfg.Networks {
+		if n.Auth != want[i] {
+			t.Errorf("%s: auth %v, want %v", n.SSID, n.Auth, want[i])
+		}
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Config
+	}{
+		{name: "empty", in: "# nothing\n\n"},
+		{
+			name: "timezone",
+			in:   `timezone = "NZST-12NZDT,M9.5.0,M4.1.0/3" # Auckland`,
+			want: Config{TimeZone: "NZST-12NZDT,M9.5.0,M4.1.0/3"},
+		},
+		{
+			name: "ntp array",
+			in:   `ntp = ["time.nist.gov:123", "pool.ntp.org:123"] # nearest first`,
+			want: Config{NTPServers: []string{"time.nist.gov:123", "pool.ntp.org:123"}},
+		},
+		{
+			name: "ntp array, spaced out",
+			in:   `ntp = [ "a:123" ,"b:123",]`,
+			want: Config{NTPServers: []string{"a:123", "b:123"}},
+		},
+		{
+			name: "ntp string",
+			in:   `ntp = "a:123"`,
+			want: Config{NTPServers: []string{"a:123"}},
+		},
+		{
+			name: "ntp empty array",
+			in:   `ntp = []`,
+		},
+		{
+			name: "resync",
+			in:   `resync = "1h30m"`,
+			want: Config{ResyncInterval: 90 * time.Minute},
+		},
+		{
+			name: "resync off",
+			in:   `resync = "0s"`,
+		},
+		{
+			name: "escapes",
+			in:   `timezone = "a\"b\\c\nd\te"`,
+			want: Config{TimeZone: "a\"b\\c\nd\te"},
+		},
+		{
+			name: "hash in a string",
+			in:   `timezone = "#1" # not this`,
+			want: Config{TimeZone: "#1"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestParseDeviceErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		line int
+	}{
+		{`timezone = "a\qb"`, 1},
+		{`timezone = "a\`, 1},
+		{`timezone = "abc`, 1},
+		{`timezone = "a" "b"`, 1},
+		{"# ok\nntp = [\"a:123\"", 2},
+		{`ntp = ["a:123" "b:123"]`, 1},
+		{`ntp = ["a:123"] trailing`, 1},
+		{`ntp = [1, 2]`, 1},
+		{`ntp = 5`, 1},
+		{`resync = "often"`, 1},
+		{`resync = 6`, 1},
+		{`colour = "red"`, 1},
+		{`timezone =`, 1},
+		{`timezone`, 1},
+		{"\n\n[[networks]]", 3},
+		{"[[network]]\npassword = \"x\"", 1},
+		{"[[network]]\nssid = \"x\"\ncolour = \"red\"", 3},
+		{"[[network]]\nssid = \"x\"\nauth = \"wep\"", 3},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.in))
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("Parse(%q): got %v, want a syntax error", tt.in, err)
+			continue
+		}
+		if serr.Line != tt.line {
+			t.Errorf("Parse(%q): error on line %d, want %d", tt.in, serr.Line, tt.line)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"os"
+
+	"tinygo.org/x/tinyfs"
+)
+
+const (
+	// FileName is where the configuration lives on the flash filesystem.
+	FileName = "/config.txt"
+	tmpName  = "/config.tmp"
+)
+
+// Load reads and parses the configuration file from fs.
+func Load(fs tinyfs.Filesystem) (*Config, error) {
+	f, err := fs.Open(FileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Save validates data as a configuration file, then atomically replaces the one on fs with it. The parsed
+// configuration is returned.
+func Save(fs tinyfs.Filesystem, data []byte) (*Config, error) {
+	c, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fs.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	// littlefs can't take an empty write
+	if len(data) > 0 {
+		_, err = f.Write(data)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fs.Rename(tmpName, FileName)
+	}
+	if err != nil {
+		_ = fs.Remove(tmpName)
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"tinygo.org/x/tinyfs"
+	"tinygo.org/x/tinyfs/littlefs"
+)
+
+// newFS returns a freshly formatted littlefs volume on an in-memory block device.
+func newFS(t *testing.T) *littlefs.LFS {
+	t.Helper()
+	fs := littlefs.New(tinyfs.NewMemoryDevice(256, 4096, 64))
+	fs.Configure(&littlefs.Config{
+		CacheSize:     256,
+		LookaheadSize: 32,
+		BlockCycles:   100,
+	})
+	if err := fs.Format(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mount(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fs.Unmount() })
+	return fs
+}
+
+func readFile(t *testing.T, fs tinyfs.Filesystem, name string) string {
+	t.Helper()
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStore(t *testing.T) {
+	fs := newFS(t)
+	if _, err := Load(fs); err == nil {
+		t.Error("Load with no file: no error")
+	}
+
+	good := "timezone = \"JST-9\"\n\n[[network]]\nssid = \"home\"\npassword = \"hunter2\"\n"
+	saved, err := Save(fs, []byte(good))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved, loaded) {
+		t.Errorf("saved %+v, but loaded %+v", saved, loaded)
+	}
+	if loaded.TimeZone != "JST-9" || len(loaded.Networks) != 1 {
+		t.Errorf("loaded %+v", loaded)
+	}
+
+	// anything that doesn't parse is rejected before the file is touched
+	for _, bad := range []string{
+		"timezone = \"JST-9\n",
+		"[[network]]\npassword = \"no ssid\"\n",
+		"resync = \"soon\"\n",
+		"\x00\x01\x02",
+	} {
+		if _, err := Save(fs, []byte(bad)); err == nil {
+			t.Errorf("Save(%q): no error", bad)
+		}
+		if got := readFile(t, fs, FileName); got != good {
+			t.Errorf("after Save(%q): config.txt is %q, want it unchanged", bad, got)
+		}
+		if _, err := fs.Stat(tmpName); err == nil {
+			t.Errorf("after Save(%q): %s left behind", bad, tmpName)
+		}
+	}
+
+	// an empty file is valid, and replaces it
+	if _, err := Save(fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, fs, FileName); got != "" {
+		t.Errorf("after saving an empty file: config.txt is %q", got)
+	}
+}
@@ -0,0 +1,65 @@
+// Package drift estimates how fast or slow the RTC runs between NTP syncs, and the PCF8523 offset register setting
+// that corrects it.
+package drift
+
+import (
+	"math"
+	"time"
+)
+
+// PCF8523Step is the correction, in ppm, of one LSB of the PCF8523 offset register when correcting every two hours.
+const PCF8523Step = 4.34
+
+// the PCF8523 offset register is seven bits, two's complement
+const (
+	pcf8523MinOffset = -64
+	pcf8523MaxOffset = 63
+)
+
+// MinObservation is the shortest time between syncs that is trusted to measure drift. Shorter intervals are dominated
+// by the error in reading the RTC. It's well under the default resync interval, so that scheduling jitter doesn't decide
+// whether a resync measures drift.
+const MinObservation = 2 * time.Hour
+
+// Estimator measures RTC drift between the time the RTC was last set and the next sync.
+type Estimator struct {
+	since   time.Time
+	started bool
+
+	// PPM is the most recently measured drift, in parts per million. It is positive if the RTC runs fast.
+	PPM float64
+}
+
+// Start records that the RTC was set to the correct time at now.
+func (e *Estimator) Start(now time.Time) {
+	e.since = now
+	e.started = true
+}
+
+// Observe compares rtc, the RTC's reading at the correct time now, against the time that has passed since Start. It
+// returns the drift in ppm (positive if the RTC runs fast), and whether enough time has passed for it to be meaningful.
+func (e *Estimator) Observe(rtc, now time.Time) (float64, bool) {
+	if !e.started {
+		return 0, false
+	}
+	elapsed := now.Sub(e.since)
+	if elapsed < MinObservation {
+		return 0, false
+	}
+
+	e.PPM = float64(rtc.Sub(now)) / float64(elapsed) * 1e6
+	return e.PPM, true
+}
+
+// PCF8523Offset returns the offset register value that corrects a measured drift of ppm, given that current was
+// programmed while the drift was measured. A positive value speeds the RTC up, so a fast RTC gets a lower value.
+func PCF8523Offset(current int8, ppm float64) int8 {
+	v := int(current) - int(math.Round(ppm/PCF8523Step))
+	if v < pcf8523MinOffset {
+		v = pcf8523MinOffset
+	}
+	if v > pcf8523MaxOffset {
+		v = pcf8523MaxOffset
+	}
+	return int8(v)
+}
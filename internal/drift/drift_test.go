@@ -0,0 +1,72 @@
+package drift
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var e Estimator
+	if _, ok := e.Observe(start, start.Add(MinObservation)); ok {
+		t.Error("observed before Start")
+	}
+
+	e.Start(start)
+	now := start.Add(MinObservation - time.Minute)
+	if _, ok := e.Observe(now, now); ok {
+		t.Error("observed before MinObservation")
+	}
+
+	tests := []struct {
+		elapsed  time.Duration
+		rtcAhead time.Duration
+		ppm      float64
+	}{
+		{6 * time.Hour, 216 * time.Millisecond, 10},
+		{6 * time.Hour, -432 * time.Millisecond, -20},
+		{48 * time.Hour, 0, 0},
+		{MinObservation, 72 * time.Millisecond, 10},
+	}
+	for _, tt := range tests {
+		now := start.Add(tt.elapsed)
+		ppm, ok := e.Observe(now.Add(tt.rtcAhead), now)
+		if !ok {
+			t.Errorf("%s: not observed", tt.elapsed)
+			continue
+		}
+		if d := ppm - tt.ppm; d < -1e-6 || d > 1e-6 {
+			t.Errorf("%s ahead by %s: got %f ppm, want %f", tt.elapsed, tt.rtcAhead, ppm, tt.ppm)
+		}
+	}
+}
+
+func TestPCF8523Offset(t *testing.T) {
+	tests := []struct {
+		current int8
+		ppm     float64
+		want    int8
+	}{
+		{0, 0, 0},
+		// a fast RTC is slowed down with a lower offset, and a slow one sped up with a higher one
+		{0, 4.34, -1},
+		{0, -4.34 * 3, 3},
+		{5, 2 * 4.34, 3},
+		{5, 1, 5},
+		{-60, 100, -64},
+		{60, -100, 63},
+	}
+	for _, tt := range tests {
+		if got := PCF8523Offset(tt.current, tt.ppm); got != tt.want {
+			t.Errorf("PCF8523Offset(%d, %f) = %d, want %d", tt.current, tt.ppm, got, tt.want)
+		}
+	}
+
+	// whatever the current value, correcting a fast RTC must lower the offset
+	for _, current := range []int8{-10, 0, 10} {
+		if got := PCF8523Offset(current, 20); got >= current {
+			t.Errorf("RTC 20ppm fast at offset %d: got %d, want lower", current, got)
+		}
+	}
+}
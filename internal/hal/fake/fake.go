@@ -0,0 +1,173 @@
+// Package fake has in-memory implementations of the hal interfaces, for running the badge's logic off-target.
+package fake
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrNoDevice = errors.New("no device at address")
+
+// Pin is a pin whose level is whatever was last set, by the code under test or the test itself.
+type Pin struct {
+	High bool
+}
+
+func (p *Pin) Get() bool {
+	return p.High
+}
+
+func (p *Pin) Set(high bool) {
+	p.High = high
+}
+
+// I2C is a bus of devices that are each modelled as a bank of registers: the first byte written selects a register,
+// following bytes are written from there, and reads continue from there. A device without registers, like the
+// PCF8574, is a bank of one that's always read and written at 0.
+type I2C struct {
+	mu      sync.Mutex
+	devices map[uint16][]byte
+	// Transactions and Bytes count bus traffic, including to missing devices.
+	Transactions int
+	Bytes        int
+}
+
+// Attach adds a device at addr with size registers, or replaces its registers if it's already there.
+func (b *I2C) Attach(addr uint16, size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.devices == nil {
+		b.devices = make(map[uint16][]byte)
+	}
+	b.devices[addr] = make([]byte, size)
+}
+
+// Registers returns a copy of the registers of the device at addr, for the test to inspect, or nil if there isn't one.
+func (b *I2C) Registers(addr uint16) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	regs, ok := b.devices[addr]
+	if !ok {
+		return nil
+	}
+	return append([]byte(nil), regs...)
+}
+
+// SetRegisters sets the registers of the device at addr from reg on to v, as the device itself would, and reports
+// whether that changed any of them. It doesn't count as bus traffic. It panics if there's no device at addr, or v runs
+// past its registers.
+func (b *I2C) SetRegisters(addr uint16, reg int, v ...byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	regs, ok := b.devices[addr]
+	if !ok {
+		panic(ErrNoDevice)
+	}
+	changed := false
+	for i, x := range v {
+		if regs[reg+i] != x {
+			regs[reg+i] = x
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (b *I2C) Tx(addr uint16, w, r []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Transactions++
+	b.Bytes += len(w) + len(r)
+
+	regs, ok := b.devices[addr]
+	if !ok {
+		return ErrNoDevice
+	}
+	p := 0
+	if len(regs) > 1 && len(w) > 0 {
+		p, w = int(w[0]), w[1:]
+	}
+	for _, v := range w {
+		regs[p%len(regs)] = v
+		if len(regs) > 1 {
+			p++
+		}
+	}
+	for i := range r {
+		r[i] = regs[p%len(regs)]
+		if len(regs) > 1 {
+			p++
+		}
+	}
+	return nil
+}
+
+func (b *I2C) ReadRegister(addr uint8, r uint8, buf []byte) error {
+	return b.Tx(uint16(addr), []byte{r}, buf)
+}
+
+func (b *I2C) WriteRegister(addr uint8, r uint8, buf []byte) error {
+	return b.Tx(uint16(addr), append([]byte{r}, buf...), nil)
+}
+
+// SPI records what was written to it, and reads back Reply, or zeros once that runs out.
+type SPI struct {
+	Written []byte
+	Reply   []byte
+}
+
+func (s *SPI) Tx(w, r []byte) error {
+	s.Written = append(s.Written, w...)
+	for i := range r {
+		r[i], _ = s.next()
+	}
+	return nil
+}
+
+func (s *SPI) Transfer(b byte) (byte, error) {
+	s.Written = append(s.Written, b)
+	return s.next()
+}
+
+func (s *SPI) next() (byte, error) {
+	if len(s.Reply) == 0 {
+		return 0, nil
+	}
+	v := s.Reply[0]
+	s.Reply = s.Reply[1:]
+	return v, nil
+}
+
+// ADC returns Value.
+type ADC struct {
+	Value uint16
+}
+
+func (a *ADC) Get() uint16 {
+	return a.Value
+}
+
+// Timer ticks only when told to, by Advance.
+type Timer struct {
+	Rate float32
+	tick func()
+}
+
+func (t *Timer) SetRate(hz uint32) float32 {
+	t.Rate = float32(hz)
+	return t.Rate
+}
+
+func (t *Timer) Start(tick func()) {
+	t.tick = tick
+}
+
+// Advance ticks n times, if the timer has been started.
+func (t *Timer) Advance(n int) {
+	if t.tick == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		t.tick()
+	}
+}
@@ -0,0 +1,139 @@
+package fake
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestI2CRegisters(t *testing.T) {
+	var b I2C
+	b.Attach(0x5A, 4)
+
+	// a write selects the register, then writes from there
+	if err := b.WriteRegister(0x5A, 1, []byte{0x11, 0x22}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Registers(0x5A), []byte{0, 0x11, 0x22, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after write: registers %x, want %x", got, want)
+	}
+
+	// reads continue from the selected register, wrapping around the bank
+	r := make([]byte, 4)
+	if err := b.ReadRegister(0x5A, 2, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x22, 0, 0, 0x11}; !reflect.DeepEqual(r, want) {
+		t.Errorf("read from 2: %x, want %x", r, want)
+	}
+
+	if b.Transactions != 2 || b.Bytes != 3+5 {
+		t.Errorf("counted %d transactions and %d bytes, want 2 and 8", b.Transactions, b.Bytes)
+	}
+}
+
+func TestI2CSingleRegister(t *testing.T) {
+	var b I2C
+	b.Attach(0x20, 1)
+
+	// a device like the PCF8574 has no register address: every byte is the port
+	if err := b.Tx(0x20, []byte{0xF0, 0x0F}, nil); err != nil {
+		t.Fatal(err)
+	}
+	r := make([]byte, 2)
+	if err := b.Tx(0x20, nil, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x0F, 0x0F}; !reflect.DeepEqual(r, want) {
+		t.Errorf("read %x, want %x", r, want)
+	}
+}
+
+func TestI2CNoDevice(t *testing.T) {
+	var b I2C
+	b.Attach(0x20, 1)
+	if err := b.Tx(0x21, []byte{1}, nil); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("write to missing device: got %v, want %v", err, ErrNoDevice)
+	}
+	if b.Transactions != 1 {
+		t.Errorf("counted %d transactions, want 1", b.Transactions)
+	}
+	if regs := b.Registers(0x21); regs != nil {
+		t.Errorf("registers of missing device: %x, want nil", regs)
+	}
+}
+
+func TestI2CSetRegisters(t *testing.T) {
+	var b I2C
+	b.Attach(0x5A, 3)
+
+	if !b.SetRegisters(0x5A, 1, 7, 8) {
+		t.Error("setting new values: not changed")
+	}
+	if b.SetRegisters(0x5A, 1, 7, 8) {
+		t.Error("setting the same values: changed")
+	}
+	if got, want := b.Registers(0x5A), []byte{0, 7, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("registers %x, want %x", got, want)
+	}
+	if b.Transactions != 0 {
+		t.Errorf("counted %d transactions, want none", b.Transactions)
+	}
+
+	// the copy doesn't alias the device
+	b.Registers(0x5A)[0] = 0xFF
+	if got := b.Registers(0x5A)[0]; got != 0 {
+		t.Errorf("changing the copy changed the register to %x", got)
+	}
+}
+
+// TestI2CConcurrent is for -race: the test's side and the code under test's side may run in different goroutines.
+func TestI2CConcurrent(t *testing.T) {
+	var b I2C
+	b.Attach(0x20, 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			b.SetRegisters(0x20, 0, byte(i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		r := make([]byte, 1)
+		for i := 0; i < 1000; i++ {
+			_ = b.Tx(0x20, nil, r)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSPI(t *testing.T) {
+	s := SPI{Reply: []byte{1, 2}}
+	r := make([]byte, 3)
+	if err := s.Tx([]byte{9, 8, 7}, r); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Transfer(6); v != 0 {
+		t.Errorf("transfer after the reply ran out: %d, want 0", v)
+	}
+	if want := []byte{1, 2, 0}; !reflect.DeepEqual(r, want) {
+		t.Errorf("read %v, want %v", r, want)
+	}
+	if want := []byte{9, 8, 7, 6}; !reflect.DeepEqual(s.Written, want) {
+		t.Errorf("written %v, want %v", s.Written, want)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	var tm Timer
+	ticks := 0
+	tm.Advance(3)
+	tm.Start(func() { ticks++ })
+	tm.Advance(5)
+	if ticks != 5 {
+		t.Errorf("%d ticks, want 5, and none before Start", ticks)
+	}
+}
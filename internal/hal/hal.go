@@ -0,0 +1,37 @@
+// Package hal is the small slice of the hardware that the badge's logic needs: digital pins, I2C and SPI buses, an
+// ADC and a periodic timer. The logic is written against these interfaces, so it builds and runs off-target against
+// the fakes in package fake; the real implementations are the TinyGo machine package's types, plus what's in this
+// package for the SAMD51.
+package hal
+
+// Pin is a digital pin.
+type Pin interface {
+	Get() bool
+	Set(high bool)
+}
+
+// I2C is an I2C bus. It matches tinygo.org/x/drivers.I2C, so any bus can be given to the device drivers too.
+type I2C interface {
+	ReadRegister(addr uint8, r uint8, buf []byte) error
+	WriteRegister(addr uint8, r uint8, buf []byte) error
+	Tx(addr uint16, w, r []byte) error
+}
+
+// SPI is an SPI bus, with chip select handled by the caller.
+type SPI interface {
+	Tx(w, r []byte) error
+	Transfer(b byte) (byte, error)
+}
+
+// ADC reads an analog pin, scaled to 16 bits however many the converter has.
+type ADC interface {
+	Get() uint16
+}
+
+// Timer calls a function periodically.
+type Timer interface {
+	// SetRate sets how many times a second the timer ticks, and returns the rate it can actually achieve.
+	SetRate(hz uint32) float32
+	// Start calls tick at the set rate. tick may be called from an interrupt handler.
+	Start(tick func())
+}
@@ -0,0 +1,33 @@
+package hal
+
+import "sync"
+
+// LockedI2C serializes the transactions on an I2C bus that's shared between goroutines, such as the main loop and a
+// background task.
+type LockedI2C struct {
+	mu  sync.Mutex
+	bus I2C
+}
+
+// NewLockedI2C returns bus with each transaction made while holding a lock.
+func NewLockedI2C(bus I2C) *LockedI2C {
+	return &LockedI2C{bus: bus}
+}
+
+func (b *LockedI2C) ReadRegister(addr uint8, r uint8, buf []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bus.ReadRegister(addr, r, buf)
+}
+
+func (b *LockedI2C) WriteRegister(addr uint8, r uint8, buf []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bus.WriteRegister(addr, r, buf)
+}
+
+func (b *LockedI2C) Tx(addr uint16, w, r []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bus.Tx(addr, w, r)
+}
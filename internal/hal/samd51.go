@@ -0,0 +1,153 @@
+//go:build atsamd51
+
+package hal
+
+import (
+	"device/sam"
+	"machine"
+	"runtime/interrupt"
+)
+
+// the machine package's types are the real implementations
+var (
+	_ Pin = machine.Pin(0)
+	_ I2C = (*machine.I2C)(nil)
+	_ SPI = (*machine.SPI)(nil)
+	_ ADC = machine.ADC{}
+)
+
+// NewFreeRunningADC configures the ADC for pin to convert continuously at 12 bits, so that Get returns the latest
+// conversion without waiting for one.
+func NewFreeRunningADC(pin machine.Pin) machine.ADC {
+	adc := machine.ADC{Pin: pin}
+	adc.Configure(machine.ADCConfig{
+		Resolution: 12,
+		Samples:    1,
+	})
+	sam.ADC0.SetCTRLB_FREERUN(1)
+	return adc
+}
+
+// frequency of the DFLL, which TinyGo uses for GCLK1
+const dfllHz = 48_000_000
+
+// TC prescaler settings and their divisors, smallest first
+var prescalers = [...]struct {
+	setting uint32
+	div     uint32
+}{
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV1, 1},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV2, 2},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV4, 4},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV8, 8},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV16, 16},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV64, 64},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV256, 256},
+	{sam.TC_COUNT16_CTRLA_PRESCALER_DIV1024, 1024},
+}
+
+// TC0 is a Timer using TC0, clocked from GCLK1.
+type TC0 struct {
+	clockHz   uint32
+	prescaler uint32
+	div       uint32
+	cc        uint16
+	tick      func()
+}
+
+var tc0 *TC0
+
+// NewTC0 returns the TC0 timer. Creating more than one is not allowed.
+func NewTC0() *TC0 {
+	if tc0 != nil {
+		panic("cannot create more than one TC0 timer")
+	}
+	tc0 = &TC0{
+		clockHz: gclk1Hz(),
+		div:     1,
+		cc:      0xFFFF,
+	}
+	return tc0
+}
+
+// SetRate implements Timer. It picks the smallest prescaler that lets the timer period fit in 16 bits, for the best
+// resolution.
+func (t *TC0) SetRate(hz uint32) float32 {
+	if hz == 0 {
+		hz = 1
+	}
+	for _, p := range prescalers {
+		// in match frequency mode the counter resets after reaching CC0, so each period is CC0+1 ticks
+		ticks := (t.clockHz/p.div + hz/2) / hz
+		if ticks <= 0x10000 || p.div == 1024 {
+			if ticks < 2 {
+				ticks = 2
+			} else if ticks > 0x10000 {
+				ticks = 0x10000
+			}
+			t.prescaler, t.div, t.cc = p.setting, p.div, uint16(ticks-1)
+			break
+		}
+	}
+	return float32(t.clockHz) / float32(t.div) / float32(uint32(t.cc)+1)
+}
+
+// Start implements Timer. tick is called from the TC0 interrupt.
+func (t *TC0) Start(tick func()) {
+	t.tick = tick
+
+	i := interrupt.New(sam.IRQ_TC0, tc0IRQ)
+	i.Enable()
+
+	// configure timer
+	sam.MCLK.SetAPBAMASK_TC0_(1)
+	sam.GCLK.PCHCTRL[sam.PCHCTRL_GCLK_TC0].Set(sam.GCLK_PCHCTRL_GEN_GCLK1 | 1<<sam.GCLK_PCHCTRL_CHEN_Pos)
+	for sam.GCLK.SYNCBUSY.Get() != 0 {
+	}
+	tc := sam.TC0_COUNT16
+	tc.SetCTRLA_ENABLE(0)
+	for tc.SYNCBUSY.Get() != 0 {
+	}
+	tc.SetCTRLA_PRESCALER(t.prescaler)
+	tc.WAVE.Set(sam.TC_COUNT16_WAVE_WAVEGEN_MFRQ)
+	for tc.SYNCBUSY.Get() != 0 {
+	}
+	// enable interrupt
+	tc.SetINTENSET_MC0(1)
+	tc.CC[0].Set(0xFFFF)
+
+	// start timer
+	tc.CC[0].Set(t.cc)
+	for tc.SYNCBUSY.HasBits(sam.TC_COUNT16_SYNCBUSY_CC0 | sam.TC_COUNT16_SYNCBUSY_CC1) {
+	}
+	tc.SetCTRLA_ENABLE(1)
+}
+
+func tc0IRQ(_ interrupt.Interrupt) {
+	tc0.tick()
+	sam.TC0_COUNT16.SetINTFLAG_MC0(1)
+}
+
+// gclk1Hz works out the frequency of GCLK1 from its generator configuration.
+func gclk1Hz() uint32 {
+	gen := sam.GCLK.GENCTRL[1].Get()
+
+	var hz uint32
+	switch (gen & sam.GCLK_GENCTRL_SRC_Msk) >> sam.GCLK_GENCTRL_SRC_Pos {
+	case sam.GCLK_GENCTRL_SRC_DPLL0:
+		// TinyGo runs the CPU from DPLL0
+		hz = machine.CPUFrequency()
+	default:
+		hz = dfllHz
+	}
+
+	div := (gen & sam.GCLK_GENCTRL_DIV_Msk) >> sam.GCLK_GENCTRL_DIV_Pos
+	switch {
+	case gen&sam.GCLK_GENCTRL_DIVSEL != 0:
+		// the division factor is 2^(DIV+1)
+		hz >>= div + 1
+	case div > 1:
+		hz /= div
+	}
+	return hz
+}
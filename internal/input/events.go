@@ -0,0 +1,192 @@
+package input
+
+import (
+	"math/bits"
+	"time"
+)
+
+// EventKind is what happened to a button.
+type EventKind uint8
+
+const (
+	// Press is reported when a button goes down, including the buttons of a chord; see Event.With.
+	Press EventKind = iota + 1
+	// Release is reported when a button comes back up.
+	Release
+	// Repeat is reported while a repeating button is held, after Decoder.RepeatDelay.
+	Repeat
+	// LongPress is reported once when a button has been held for Decoder.LongPress.
+	LongPress
+	// Chord is reported when a button goes down while others are held.
+	Chord
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Press:
+		return "press"
+	case Release:
+		return "release"
+	case Repeat:
+		return "repeat"
+	case LongPress:
+		return "long press"
+	case Chord:
+		return "chord"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a button event.
+type Event struct {
+	Kind EventKind
+	// Buttons is the button the event is for, as a bitmask with one bit set, or all the buttons held for a Chord.
+	Buttons byte
+	// Held is how long the button was held, for Release, LongPress and Repeat.
+	Held time.Duration
+	// With is the buttons already held when the button went down, for Press. If there are any, the press is part of a
+	// chord, and a Chord event follows it.
+	With byte
+}
+
+// Has reports whether button is one of the event's buttons.
+func (e Event) Has(button int) bool {
+	return e.Buttons&(1<<button) != 0
+}
+
+// events queued between calls to Next; more than a few means nobody is reading them
+const queueSize = 16
+
+// Decoder turns button bitmasks, as read by Buttons, into events. Feed it with Update as often as the buttons are
+// read, and take the events with Next.
+//
+// A button only counts as changed once it's read the same for Debounce. Once a chord has been pressed, there are no
+// repeats or long presses until every button has been let go, so that letting go of one button of the chord first
+// doesn't count as holding the other.
+type Decoder struct {
+	// Debounce is how long a button must read the same before it counts as pressed or released.
+	Debounce time.Duration
+	// RepeatButtons is a bitmask of the buttons that repeat while held.
+	RepeatButtons byte
+	// RepeatDelay is how long a button must be held before it starts to repeat, and RepeatInterval is how often it
+	// repeats after that.
+	RepeatDelay    time.Duration
+	RepeatInterval time.Duration
+	// LongPress is how long a button must be held to count as a long press. 0 disables long presses.
+	LongPress time.Duration
+
+	raw     byte
+	changed [8]time.Time
+	held    byte
+	chorded bool
+
+	pressed    [8]time.Time
+	nextRepeat [8]time.Time
+	long       byte
+
+	queue      [queueSize]Event
+	head, size int
+}
+
+// NewDecoder returns a Decoder with defaults that suit the badge's buttons, with up and down repeating.
+func NewDecoder() *Decoder {
+	return &Decoder{
+		Debounce:       20 * time.Millisecond,
+		RepeatButtons:  1<<Up | 1<<Down,
+		RepeatDelay:    500 * time.Millisecond,
+		RepeatInterval: 100 * time.Millisecond,
+		LongPress:      time.Second,
+	}
+}
+
+// Held returns the debounced buttons held down.
+func (d *Decoder) Held() byte {
+	return d.held
+}
+
+// Update takes the buttons read at now, and queues any events.
+func (d *Decoder) Update(raw byte, now time.Time) {
+	for i := 0; i < 8; i++ {
+		bit := byte(1) << i
+		if (raw^d.raw)&bit != 0 {
+			d.changed[i] = now
+		}
+	}
+	d.raw = raw
+
+	// releases first, so that letting go of one button and pressing another in the same read isn't a chord
+	for i := 0; i < 8; i++ {
+		bit := byte(1) << i
+		if d.held&bit != 0 && raw&bit == 0 && d.stable(i, now) {
+			d.held &^= bit
+			d.long &^= bit
+			d.push(Event{Kind: Release, Buttons: bit, Held: now.Sub(d.pressed[i])})
+		}
+	}
+	if d.held == 0 {
+		d.chorded = false
+	}
+	for i := 0; i < 8; i++ {
+		bit := byte(1) << i
+		if d.held&bit == 0 && raw&bit != 0 && d.stable(i, now) {
+			with := d.held
+			d.held |= bit
+			d.pressed[i] = now
+			d.nextRepeat[i] = now.Add(d.RepeatDelay)
+			d.push(Event{Kind: Press, Buttons: bit, With: with})
+			if bits.OnesCount8(d.held) > 1 {
+				d.chorded = true
+				d.push(Event{Kind: Chord, Buttons: d.held})
+			}
+		}
+	}
+	if d.chorded {
+		return
+	}
+
+	for i := 0; i < 8; i++ {
+		bit := byte(1) << i
+		if d.held&bit == 0 {
+			continue
+		}
+		held := now.Sub(d.pressed[i])
+		if d.RepeatButtons&bit != 0 && !now.Before(d.nextRepeat[i]) {
+			d.push(Event{Kind: Repeat, Buttons: bit, Held: held})
+			d.nextRepeat[i] = d.nextRepeat[i].Add(d.RepeatInterval)
+			if d.nextRepeat[i].Before(now) {
+				// reads were too far apart to keep up; don't burst to catch up
+				d.nextRepeat[i] = now.Add(d.RepeatInterval)
+			}
+		}
+		if d.LongPress > 0 && d.long&bit == 0 && held >= d.LongPress {
+			d.long |= bit
+			d.push(Event{Kind: LongPress, Buttons: bit, Held: held})
+		}
+	}
+}
+
+// stable reports whether button i has read the same for long enough to count.
+func (d *Decoder) stable(i int, now time.Time) bool {
+	return now.Sub(d.changed[i]) >= d.Debounce
+}
+
+// Next returns the oldest queued event, if there is one.
+func (d *Decoder) Next() (Event, bool) {
+	if d.size == 0 {
+		return Event{}, false
+	}
+	e := d.queue[d.head]
+	d.head = (d.head + 1) % queueSize
+	d.size--
+	return e, true
+}
+
+// push queues e, dropping it if the queue is full.
+func (d *Decoder) push(e Event) {
+	if d.size == queueSize {
+		return
+	}
+	d.queue[(d.head+d.size)%queueSize] = e
+	d.size++
+}
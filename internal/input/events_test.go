@@ -0,0 +1,243 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// change is the buttons read from a time on.
+type change struct {
+	at  time.Duration
+	raw byte
+}
+
+// timedEvent is an event and when it was taken from the Decoder.
+type timedEvent struct {
+	at time.Duration
+	e  Event
+}
+
+// decode feeds the changes to d every 10ms until end, taking events after every update, and returns them.
+func decode(d *Decoder, changes []change, end time.Duration) []timedEvent {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var got []timedEvent
+	raw := byte(0)
+	for at := time.Duration(0); at <= end; at += 10 * time.Millisecond {
+		for len(changes) > 0 && changes[0].at <= at {
+			raw = changes[0].raw
+			changes = changes[1:]
+		}
+		d.Update(raw, start.Add(at))
+		for {
+			e, ok := d.Next()
+			if !ok {
+				break
+			}
+			got = append(got, timedEvent{at, e})
+		}
+	}
+	return got
+}
+
+const ms = time.Millisecond
+
+func TestDecoder(t *testing.T) {
+	const (
+		up   = 1 << Up
+		down = 1 << Down
+		menu = 1 << Menu
+		back = 1 << Back
+	)
+	tests := []struct {
+		name    string
+		changes []change
+		end     time.Duration
+		want    []timedEvent
+	}{
+		{
+			name:    "tap",
+			changes: []change{{100 * ms, back}, {200 * ms, 0}},
+			end:     400 * ms,
+			want: []timedEvent{
+				{120 * ms, Event{Kind: Press, Buttons: back}},
+				{220 * ms, Event{Kind: Release, Buttons: back, Held: 100 * ms}},
+			},
+		},
+		{
+			name: "debounce",
+			// contacts bouncing on the way down and up, each bounce shorter than Debounce
+			changes: []change{
+				{100 * ms, back}, {110 * ms, 0}, {120 * ms, back}, {130 * ms, 0}, {140 * ms, back},
+				{300 * ms, 0}, {310 * ms, back}, {320 * ms, 0},
+			},
+			end: 500 * ms,
+			want: []timedEvent{
+				{160 * ms, Event{Kind: Press, Buttons: back}},
+				{340 * ms, Event{Kind: Release, Buttons: back, Held: 180 * ms}},
+			},
+		},
+		{
+			name:    "glitch",
+			changes: []change{{100 * ms, back}, {110 * ms, 0}},
+			end:     400 * ms,
+		},
+		{
+			name:    "repeat",
+			changes: []change{{100 * ms, up}, {850 * ms, 0}},
+			end:     1200 * ms,
+			want: []timedEvent{
+				{120 * ms, Event{Kind: Press, Buttons: up}},
+				{620 * ms, Event{Kind: Repeat, Buttons: up, Held: 500 * ms}},
+				{720 * ms, Event{Kind: Repeat, Buttons: up, Held: 600 * ms}},
+				{820 * ms, Event{Kind: Repeat, Buttons: up, Held: 700 * ms}},
+				{870 * ms, Event{Kind: Release, Buttons: up, Held: 750 * ms}},
+			},
+		},
+		{
+			name:    "long press",
+			changes: []change{{100 * ms, menu}, {1500 * ms, 0}},
+			end:     2000 * ms,
+			want: []timedEvent{
+				{120 * ms, Event{Kind: Press, Buttons: menu}},
+				{1120 * ms, Event{Kind: LongPress, Buttons: menu, Held: time.Second}},
+				{1520 * ms, Event{Kind: Release, Buttons: menu, Held: 1400 * ms}},
+			},
+		},
+		{
+			name:    "repeat and long press",
+			changes: []change{{0, down}, {1050 * ms, 0}},
+			end:     1200 * ms,
+			want: []timedEvent{
+				{20 * ms, Event{Kind: Press, Buttons: down}},
+				{520 * ms, Event{Kind: Repeat, Buttons: down, Held: 500 * ms}},
+				{620 * ms, Event{Kind: Repeat, Buttons: down, Held: 600 * ms}},
+				{720 * ms, Event{Kind: Repeat, Buttons: down, Held: 700 * ms}},
+				{820 * ms, Event{Kind: Repeat, Buttons: down, Held: 800 * ms}},
+				{920 * ms, Event{Kind: Repeat, Buttons: down, Held: 900 * ms}},
+				{1020 * ms, Event{Kind: Repeat, Buttons: down, Held: time.Second}},
+				{1020 * ms, Event{Kind: LongPress, Buttons: down, Held: time.Second}},
+				{1070 * ms, Event{Kind: Release, Buttons: down, Held: 1050 * ms}},
+			},
+		},
+		{
+			name: "chord",
+			// up, then down with it; up is let go first, and down is held on long past the repeat delay and long press,
+			// then pressed again on its own
+			changes: []change{{100 * ms, up}, {200 * ms, up | down}, {400 * ms, down}, {1800 * ms, 0}, {2000 * ms, down}},
+			end:     2600 * ms,
+			want: []timedEvent{
+				{120 * ms, Event{Kind: Press, Buttons: up}},
+				{220 * ms, Event{Kind: Press, Buttons: down, With: up}},
+				{220 * ms, Event{Kind: Chord, Buttons: up | down}},
+				{420 * ms, Event{Kind: Release, Buttons: up, Held: 300 * ms}},
+				{1820 * ms, Event{Kind: Release, Buttons: down, Held: 1600 * ms}},
+				{2020 * ms, Event{Kind: Press, Buttons: down}},
+				{2520 * ms, Event{Kind: Repeat, Buttons: down, Held: 500 * ms}},
+			},
+		},
+		{
+			name: "pressed together",
+			// the lower bit's press comes first, and the other is part of the chord
+			changes: []change{{100 * ms, back | menu}, {200 * ms, back | menu | up}, {300 * ms, 0}},
+			end:     400 * ms,
+			want: []timedEvent{
+				{120 * ms, Event{Kind: Press, Buttons: back}},
+				{120 * ms, Event{Kind: Press, Buttons: menu, With: back}},
+				{120 * ms, Event{Kind: Chord, Buttons: back | menu}},
+				{220 * ms, Event{Kind: Press, Buttons: up, With: back | menu}},
+				{220 * ms, Event{Kind: Chord, Buttons: back | menu | up}},
+				{320 * ms, Event{Kind: Release, Buttons: back, Held: 200 * ms}},
+				{320 * ms, Event{Kind: Release, Buttons: menu, Held: 200 * ms}},
+				{320 * ms, Event{Kind: Release, Buttons: up, Held: 100 * ms}},
+			},
+		},
+		{
+			name: "let go and press in one read",
+			// back released and menu pressed together isn't a chord
+			changes: []change{{100 * ms, back}, {200 * ms, menu}, {300 * ms, 0}},
+			end:     400 * ms,
+			want: []timedEvent{
+				{120 * ms, Event{Kind: Press, Buttons: back}},
+				{220 * ms, Event{Kind: Release, Buttons: back, Held: 100 * ms}},
+				{220 * ms, Event{Kind: Press, Buttons: menu}},
+				{320 * ms, Event{Kind: Release, Buttons: menu, Held: 100 * ms}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := decode(NewDecoder(), tt.changes, tt.end)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Reads too far apart to keep up repeat from then on, rather than bursting to catch up.
+func TestDecoderSlowReads(t *testing.T) {
+	d := NewDecoder()
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var repeats []time.Duration
+	for _, at := range []time.Duration{0, 20 * ms, 900 * ms, 950 * ms, 1000 * ms, 1050 * ms} {
+		d.Update(1<<Up, start.Add(at))
+		for e, ok := d.Next(); ok; e, ok = d.Next() {
+			if e.Kind == Repeat {
+				repeats = append(repeats, at)
+			}
+		}
+	}
+	if want := []time.Duration{900 * ms, 1000 * ms}; !reflect.DeepEqual(repeats, want) {
+		t.Errorf("repeated at %v, want %v", repeats, want)
+	}
+}
+
+func TestDecoderQueueFull(t *testing.T) {
+	d := NewDecoder()
+	d.Debounce = 0
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 10 taps of back is 20 events, and nothing takes them
+	for i := 0; i < 20; i++ {
+		raw := byte(0)
+		if i%2 == 0 {
+			raw = 1 << Back
+		}
+		d.Update(raw, start.Add(time.Duration(i)*ms))
+	}
+
+	// the oldest are kept, and the rest dropped
+	var got []EventKind
+	for e, ok := d.Next(); ok; e, ok = d.Next() {
+		got = append(got, e.Kind)
+	}
+	if len(got) != queueSize {
+		t.Fatalf("got %d events, want %d", len(got), queueSize)
+	}
+	for i, k := range got {
+		want := Press
+		if i%2 == 1 {
+			want = Release
+		}
+		if k != want {
+			t.Errorf("event %d: got %v, want %v", i, k, want)
+		}
+	}
+
+	// once there's room again, events are queued as before
+	d.Update(1<<Menu, start.Add(time.Second))
+	if e, ok := d.Next(); !ok || e.Kind != Press || e.Buttons != 1<<Menu {
+		t.Errorf("after emptying the queue: got %v %v, want a press of menu", e, ok)
+	}
+	if d.Held() != 1<<Menu {
+		t.Errorf("held %08b, want %08b", d.Held(), 1<<Menu)
+	}
+}
+
+func TestEventKindString(t *testing.T) {
+	for k, want := range map[EventKind]string{
+		Press: "press", Release: "release", Repeat: "repeat", LongPress: "long press", Chord: "chord", 0: "unknown",
+	} {
+		if got := k.String(); got != want {
+			t.Errorf("%d: got %q, want %q", k, got, want)
+		}
+	}
+}
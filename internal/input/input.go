@@ -0,0 +1,205 @@
+// Package input reads the badge's buttons: the two on the board, the PCF8574 GPIO expander they're wired to, and the
+// MPR121 capacitive touch sensor, whose interrupt line is wired to the expander. Everything is reached through hal,
+// so the same logic runs on the badge and in the simulator.
+package input
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/hal"
+)
+
+// PCF8574 pins, which are also the bits of the button bitmask
+const (
+	Back = iota
+	Menu
+	Up
+	Down
+	ToggleMic
+	Extra2
+	ToggleTouch
+	TouchEvent
+)
+
+// expander pins with buttons on them
+const expanderButtons = 1<<Back | 1<<Menu | 1<<Up | 1<<Down | 1<<ToggleMic | 1<<ToggleTouch
+
+// MPR121 electrodes
+const (
+	touchMenu = iota
+	touchBack
+	touchDown
+	touchUp
+	touchExtra1
+	touchExtra2
+)
+
+// MPR121 touch status registers; the first 12 bits are the electrodes
+const (
+	mpr121RegTouchStatus = 0x00
+	touchMask            = 0x0FFF
+)
+
+// Stats counts how much Buttons has used the I2C bus.
+type Stats struct {
+	// Polls is how many times the buttons were read, and Reads how many of those read the expander.
+	Polls, Reads int
+	// TouchReads is how many times the touch sensor was read.
+	TouchReads int
+	// ExpanderTime and TouchTime are the time spent on the bus reading the expander and touch sensor.
+	ExpanderTime, TouchTime time.Duration
+}
+
+// Saved estimates the bus time saved by not reading the expander on every poll, going by how long the reads that
+// were done took.
+func (s Stats) Saved() time.Duration {
+	if s.Reads == 0 {
+		return 0
+	}
+	return s.ExpanderTime / time.Duration(s.Reads) * time.Duration(s.Polls-s.Reads)
+}
+
+// Buttons reads all of the buttons into one bitmask, with a bit set for each button that's held down.
+//
+// By default the expander is read on every poll. With EnableInterrupt, it's only read once its interrupt line says
+// its pins have changed, or every so often in case an interrupt was missed.
+type Buttons struct {
+	bus      hal.I2C
+	up, down hal.Pin
+
+	expander  uint16
+	touch     uint8
+	haveTouch bool
+	// the MPR121 only signals when the electrodes change, so this is the last status it was read for
+	touched uint16
+
+	interrupts bool
+	poll       time.Duration
+	// set by Interrupt; read and written atomically
+	pending  uint32
+	lastRead time.Time
+	// the expander pins that are low, as last read
+	pins byte
+
+	stats Stats
+	// clock times the bus; it's time.Now, except in tests
+	clock func() time.Time
+
+	w [1]byte
+	r [2]byte
+}
+
+// New returns Buttons that reads the on-board up and down buttons from the given pins, which must already be
+// configured as inputs with pull-ups, and the expander at expanderAddr on bus.
+func New(bus hal.I2C, up, down hal.Pin, expanderAddr uint16) *Buttons {
+	return &Buttons{
+		bus:      bus,
+		up:       up,
+		down:     down,
+		expander: expanderAddr,
+		pending:  1,
+		clock:    time.Now,
+	}
+}
+
+// Configure makes every expander pin an input. The PCF8574's pins are quasi-bidirectional: writing a 1 turns off the
+// pin's output driver and leaves a weak pull-up, so the button can pull it low.
+func (b *Buttons) Configure() error {
+	b.w[0] = 0xFF
+	return b.bus.Tx(b.expander, b.w[:], nil)
+}
+
+// SetTouch reads touch status from the MPR121 at addr, when it signals a change. The sensor must already be
+// configured.
+func (b *Buttons) SetTouch(addr uint8) {
+	b.touch = addr
+	b.haveTouch = true
+}
+
+// EnableInterrupt stops reading the expander on every poll. Instead it's read when Interrupt has been called, or if it
+// hasn't been read for poll. The caller must arrange for Interrupt to be called when the expander's interrupt line
+// falls.
+func (b *Buttons) EnableInterrupt(poll time.Duration) {
+	b.poll = poll
+	b.interrupts = true
+}
+
+// Interrupt tells Buttons that the expander's pins have changed. It may be called from an interrupt handler.
+func (b *Buttons) Interrupt() {
+	atomic.StoreUint32(&b.pending, 1)
+}
+
+// Stats returns how much the bus has been used so far.
+func (b *Buttons) Stats() Stats {
+	return b.stats
+}
+
+// Read returns the buttons held down at now. If touch is true, touched electrodes count as the buttons they stand in
+// for; either way the MPR121's status is read when it signals a change, to clear its interrupt.
+//
+// If the expander or touch sensor can't be read, the buttons that could be read are returned along with the error.
+func (b *Buttons) Read(touch bool, now time.Time) (byte, error) {
+	b.stats.Polls++
+	cur := byte(0)
+	// buttons use pull-up resistors and short to ground, so they are *false* when pressed
+	if !b.up.Get() {
+		cur |= 1 << Up
+	}
+	if !b.down.Get() {
+		cur |= 1 << Down
+	}
+
+	// the flag is cleared before reading, so that a change during the read is caught next time
+	read := !b.interrupts || atomic.SwapUint32(&b.pending, 0) != 0 || now.Sub(b.lastRead) >= b.poll
+	if read {
+		start := b.clock()
+		err := b.bus.Tx(b.expander, nil, b.r[:1])
+		b.stats.ExpanderTime += b.clock().Sub(start)
+		b.stats.Reads++
+		if err != nil {
+			b.Interrupt()
+			return cur, err
+		}
+		b.pins = ^b.r[0]
+		b.lastRead = now
+	}
+	cur |= b.pins & expanderButtons
+
+	// capacitive touch "interrupt", which is only fresh if the expander was just read; reading the touch status
+	// clears it, which changes the expander's pins again
+	if read && b.pins&(1<<TouchEvent) != 0 && b.haveTouch {
+		start := b.clock()
+		err := b.bus.ReadRegister(b.touch, mpr121RegTouchStatus, b.r[:2])
+		b.stats.TouchTime += b.clock().Sub(start)
+		b.stats.TouchReads++
+		if err != nil {
+			b.Interrupt()
+			return cur, err
+		}
+		b.touched = uint16(b.r[0]) | uint16(b.r[1])<<8
+	}
+	if touch {
+		cur |= TouchButtons(b.touched)
+	}
+	return cur, nil
+}
+
+// TouchButtons returns the buttons that the touched electrodes, as a bitmask, stand in for.
+func TouchButtons(touched uint16) byte {
+	touched &= touchMask
+	var b byte
+	if touched&(1<<touchMenu|1<<touchExtra1|1<<touchExtra2) != 0 {
+		b |= 1 << Menu
+	}
+	if touched&(1<<touchBack) != 0 {
+		b |= 1 << Back
+	}
+	if touched&(1<<touchDown) != 0 {
+		b |= 1 << Down
+	}
+	if touched&(1<<touchUp) != 0 {
+		b |= 1 << Up
+	}
+	return b
+}
@@ -0,0 +1,287 @@
+package input
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ajanata/gotogen-hardware/internal/hal/fake"
+)
+
+// where the badge has them
+const (
+	testExpander = 0x20
+	testTouch    = 0x5A
+)
+
+// rig is Buttons wired to fake devices, with nothing pressed.
+type rig struct {
+	bus      fake.I2C
+	up, down fake.Pin
+	b        *Buttons
+	now      time.Time
+}
+
+func newRig(t *testing.T) *rig {
+	r := &rig{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r.up.High, r.down.High = true, true
+	r.bus.Attach(testExpander, 1)
+	r.bus.Attach(testTouch, 0x80)
+	r.b = New(&r.bus, &r.up, &r.down, testExpander)
+	if err := r.b.Configure(); err != nil {
+		t.Fatal(err)
+	}
+	r.b.SetTouch(testTouch)
+	return r
+}
+
+// set sets the expander pins that are pulled low, and the electrodes the touch sensor reports.
+func (r *rig) set(pins byte, touched uint16) {
+	r.bus.SetRegisters(testExpander, 0, ^pins)
+	r.bus.SetRegisters(testTouch, 0, byte(touched), byte(touched>>8))
+}
+
+// read reads the buttons 10ms after the last read.
+func (r *rig) read(t *testing.T, touch bool) byte {
+	r.now = r.now.Add(10 * time.Millisecond)
+	cur, err := r.b.Read(touch, r.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cur
+}
+
+// The MPR121 only pulls the touch event pin low when the electrodes change, and lets go once its status is read, so
+// the status has to be kept between changes.
+func TestReadTouchHeld(t *testing.T) {
+	r := newRig(t)
+	steps := []struct {
+		name    string
+		pins    byte
+		touched uint16
+		touch   bool
+		want    byte
+		reads   int
+	}{
+		{name: "touched", pins: 1 << TouchEvent, touched: 1 << touchUp, touch: true, want: 1 << Up, reads: 1},
+		{name: "event cleared", touched: 1 << touchUp, touch: true, want: 1 << Up, reads: 1},
+		{name: "still held", touched: 1 << touchUp, touch: true, want: 1 << Up, reads: 1},
+		{name: "let go", pins: 1 << TouchEvent, touch: true, want: 0, reads: 2},
+		{name: "event cleared again", touch: true, want: 0, reads: 2},
+		// with touch off, the status is still read to clear the event, but doesn't count as buttons...
+		{name: "touched while off", pins: 1 << TouchEvent, touched: 1 << touchBack, want: 0, reads: 3},
+		{name: "held while off", touched: 1 << touchBack, want: 0, reads: 3},
+		// ...until touch is turned back on
+		{name: "turned on", touched: 1 << touchBack, touch: true, want: 1 << Back, reads: 3},
+	}
+	for _, s := range steps {
+		r.set(s.pins, s.touched)
+		if got := r.read(t, s.touch); got != s.want {
+			t.Errorf("%s: got %08b, want %08b", s.name, got, s.want)
+		}
+		if got := r.b.Stats().TouchReads; got != s.reads {
+			t.Errorf("%s: touch status read %d times, want %d", s.name, got, s.reads)
+		}
+	}
+}
+
+func TestReadPins(t *testing.T) {
+	tests := []struct {
+		name     string
+		up, down bool
+		pins     byte
+		want     byte
+	}{
+		{name: "nothing", want: 0},
+		// the on-board buttons are the same as the expander's up and down; they once set the bits of gotogen's menu
+		// button numbers, so that down toggled the mic
+		{name: "on-board up", up: true, want: 1 << Up},
+		{name: "on-board down", down: true, want: 1 << Down},
+		{name: "on-board both", up: true, down: true, want: 1<<Up | 1<<Down},
+		{name: "expander", pins: 1<<Back | 1<<Menu | 1<<ToggleMic | 1<<ToggleTouch,
+			want: 1<<Back | 1<<Menu | 1<<ToggleMic | 1<<ToggleTouch},
+		{name: "both ups", up: true, pins: 1 << Up, want: 1 << Up},
+		// the spare pin, and the touch event pin when there's nothing touched
+		{name: "not buttons", pins: 1<<Extra2 | 1<<TouchEvent, want: 0},
+	}
+	for _, tt := range tests {
+		r := newRig(t)
+		r.up.High, r.down.High = !tt.up, !tt.down
+		r.set(tt.pins, 0)
+		if got := r.read(t, true); got != tt.want {
+			t.Errorf("%s: got %08b, want %08b", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTouchButtons(t *testing.T) {
+	tests := []struct {
+		touched uint16
+		want    byte
+	}{
+		{0, 0},
+		{1 << touchMenu, 1 << Menu},
+		{1 << touchBack, 1 << Back},
+		{1 << touchDown, 1 << Down},
+		{1 << touchUp, 1 << Up},
+		// both extras stand in for menu too
+		{1 << touchExtra1, 1 << Menu},
+		{1 << touchExtra2, 1 << Menu},
+		{1<<touchMenu | 1<<touchExtra2, 1 << Menu},
+		{1<<touchUp | 1<<touchDown, 1<<Up | 1<<Down},
+		// unused electrodes, and the bits above the 12 electrodes
+		{1<<6 | 1<<11, 0},
+		{0xF000, 0},
+	}
+	for _, tt := range tests {
+		if got := TouchButtons(tt.touched); got != tt.want {
+			t.Errorf("%012b: got %08b, want %08b", tt.touched, got, tt.want)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var bus fake.I2C
+	up, down := &fake.Pin{}, &fake.Pin{High: true}
+	b := New(&bus, up, down, testExpander)
+	b.EnableInterrupt(time.Hour)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the on-board buttons are still returned without the expander
+	cur, err := b.Read(true, now)
+	if !errors.Is(err, fake.ErrNoDevice) {
+		t.Errorf("no expander: got %v, want %v", err, fake.ErrNoDevice)
+	}
+	if cur != 1<<Up {
+		t.Errorf("no expander: got %08b, want %08b", cur, 1<<Up)
+	}
+
+	// a failed read is tried again on the next poll, without waiting for an interrupt
+	bus.Attach(testExpander, 1)
+	bus.SetRegisters(testExpander, 0, ^byte(1<<Menu|1<<TouchEvent))
+	b.SetTouch(testTouch)
+	cur, err = b.Read(true, now)
+	if !errors.Is(err, fake.ErrNoDevice) {
+		t.Errorf("no touch sensor: got %v, want %v", err, fake.ErrNoDevice)
+	}
+	if cur != 1<<Up|1<<Menu {
+		t.Errorf("no touch sensor: got %08b, want %08b", cur, 1<<Up|1<<Menu)
+	}
+
+	// and so is a failed touch read
+	bus.Attach(testTouch, 0x80)
+	bus.SetRegisters(testTouch, 0, 1<<touchBack)
+	cur, err = b.Read(true, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := byte(1<<Up | 1<<Menu | 1<<Back); cur != want {
+		t.Errorf("recovered: got %08b, want %08b", cur, want)
+	}
+	if s := b.Stats(); s.Polls != 3 || s.Reads != 3 || s.TouchReads != 2 {
+		t.Errorf("stats %+v, want 3 polls, 3 reads and 2 touch reads", s)
+	}
+}
+
+func TestEnableInterrupt(t *testing.T) {
+	tests := []struct {
+		name       string
+		interrupts bool
+		// the frame on which to press menu, and whether the expander interrupts for it
+		press     int
+		interrupt bool
+		// the first frame it's seen on, and how many times the expander is read in 100 frames
+		seen, reads int
+	}{
+		{name: "every poll", press: 30, seen: 30, reads: 100},
+		// first read, then every 250ms: frames 0, 25, 50 and 75
+		{name: "interrupt, no change", interrupts: true, press: 200, reads: 4},
+		{name: "interrupt", interrupts: true, press: 30, interrupt: true, seen: 30, reads: 5},
+		// a missed interrupt is caught by the next poll
+		{name: "missed interrupt", interrupts: true, press: 30, seen: 50, reads: 4},
+	}
+	for _, tt := range tests {
+		r := newRig(t)
+		if tt.interrupts {
+			r.b.EnableInterrupt(250 * time.Millisecond)
+		}
+		seen := -1
+		for frame := 0; frame < 100; frame++ {
+			if frame == tt.press {
+				r.set(1<<Menu, 0)
+				if tt.interrupt {
+					r.b.Interrupt()
+				}
+			}
+			if r.read(t, true)&(1<<Menu) != 0 && seen < 0 {
+				seen = frame
+			}
+		}
+
+		if tt.press < 100 && seen != tt.seen {
+			t.Errorf("%s: menu seen on frame %d, want %d", tt.name, seen, tt.seen)
+		}
+		s := r.b.Stats()
+		if s.Polls != 100 || s.Reads != tt.reads {
+			t.Errorf("%s: %d polls and %d reads, want 100 and %d", tt.name, s.Polls, s.Reads, tt.reads)
+		}
+		// Configure's write, and the reads; nothing is touched, so the touch sensor is never read
+		if want := 1 + tt.reads; r.bus.Transactions != want || s.TouchReads != 0 {
+			t.Errorf("%s: %d transactions and %d touch reads, want %d and none", tt.name, r.bus.Transactions,
+				s.TouchReads, want)
+		}
+	}
+}
+
+func TestReadBusTime(t *testing.T) {
+	r := newRig(t)
+	r.b.EnableInterrupt(250 * time.Millisecond)
+	// every reading of the clock is 100µs after the last, so each bus transaction takes that long
+	clock := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.b.clock = func() time.Time {
+		clock = clock.Add(100 * time.Microsecond)
+		return clock
+	}
+
+	r.set(1<<TouchEvent, 1<<touchUp)
+	for i := 0; i < 100; i++ {
+		r.read(t, true)
+		// reading the touch status lets go of the event pin
+		r.set(0, 1<<touchUp)
+	}
+	s := r.b.Stats()
+	want := Stats{
+		Polls:        100,
+		Reads:        4,
+		TouchReads:   1,
+		ExpanderTime: 400 * time.Microsecond,
+		TouchTime:    100 * time.Microsecond,
+	}
+	if s != want {
+		t.Errorf("stats %+v, want %+v", s, want)
+	}
+	if got, want := s.Saved(), 96*100*time.Microsecond; got != want {
+		t.Errorf("saved %v, want %v", got, want)
+	}
+}
+
+func TestStatsSaved(t *testing.T) {
+	tests := []struct {
+		s    Stats
+		want time.Duration
+	}{
+		{Stats{}, 0},
+		{Stats{Polls: 10}, 0},
+		// reading on every poll saves nothing
+		{Stats{Polls: 10, Reads: 10, ExpanderTime: time.Millisecond}, 0},
+		{Stats{Polls: 100, Reads: 4, ExpanderTime: 400 * time.Microsecond}, 9600 * time.Microsecond},
+		// only the expander's time counts
+		{Stats{Polls: 3, Reads: 1, ExpanderTime: time.Millisecond, TouchReads: 1, TouchTime: time.Second},
+			2 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Saved(); got != tt.want {
+			t.Errorf("%+v: saved %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
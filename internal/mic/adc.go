@@ -0,0 +1,37 @@
+package mic
+
+import "github.com/ajanata/gotogen-hardware/internal/hal"
+
+// ADCSource samples an ADC on every tick of a timer. On the badge the ADC is free-running, so reading it in the timer
+// interrupt doesn't have to wait for a conversion.
+type ADCSource struct {
+	adc   hal.ADC
+	timer hal.Timer
+	rate  float32
+	sink  func(uint16)
+}
+
+// NewADCSource sets timer to tick as close to rateHz as it can. Sampling begins when the source is given to New.
+func NewADCSource(adc hal.ADC, timer hal.Timer, rateHz uint32) *ADCSource {
+	return &ADCSource{
+		adc:   adc,
+		timer: timer,
+		rate:  timer.SetRate(rateHz),
+	}
+}
+
+// SampleRate implements SampleSource. It is the rate actually achieved, which may differ slightly from what was asked
+// for.
+func (s *ADCSource) SampleRate() float32 {
+	return s.rate
+}
+
+// Start implements SampleSource.
+func (s *ADCSource) Start(sink func(v uint16)) {
+	s.sink = sink
+	s.timer.Start(s.tick)
+}
+
+func (s *ADCSource) tick() {
+	s.sink(s.adc.Get())
+}
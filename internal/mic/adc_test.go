@@ -0,0 +1,55 @@
+package mic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ajanata/gotogen-hardware/internal/hal/fake"
+)
+
+func TestADCSource(t *testing.T) {
+	adc := &fake.ADC{}
+	timer := &fake.Timer{}
+	src := NewADCSource(adc, timer, testRate)
+	if r := src.SampleRate(); r != testRate {
+		t.Errorf("sample rate %v, want %v", r, testRate)
+	}
+	if timer.Rate != testRate {
+		t.Errorf("timer rate %v, want %v", timer.Rate, testRate)
+	}
+
+	// nothing is sampled until the source is started
+	timer.Advance(5)
+	var got []uint16
+	src.Start(func(v uint16) { got = append(got, v) })
+	for _, v := range []uint16{silence, 0, 0xFFFF, 1234} {
+		adc.Value = v
+		timer.Advance(1)
+	}
+	adc.Value = 42
+	timer.Advance(2)
+	if want := []uint16{silence, 0, 0xFFFF, 1234, 42, 42}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sampled %v, want %v", got, want)
+	}
+}
+
+// slowTimer can't quite reach the rate it's asked for, like TC0 with its integer divider.
+type slowTimer struct {
+	fake.Timer
+}
+
+func (t *slowTimer) SetRate(hz uint32) float32 {
+	return t.Timer.SetRate(hz) * 0.99
+}
+
+func TestADCSourceRate(t *testing.T) {
+	src := NewADCSource(&fake.ADC{}, &slowTimer{}, 10000)
+	if r := src.SampleRate(); r != 9900 {
+		t.Errorf("sample rate %v, want the timer's actual 9900", r)
+	}
+	// the mic sizes its window by the actual rate
+	m := New(src, testWindow)
+	if want := int(9900 * testWindow.Seconds()); m.Size() < want-1 || m.Size() > want+1 {
+		t.Errorf("window of %d samples, want about %d", m.Size(), want)
+	}
+}
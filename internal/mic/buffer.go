@@ -0,0 +1,125 @@
+package mic
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// buffer is a fixed-size ring of the most recent samples. add is called from the sampling interrupt, and is the only
+// writer; everything else reads through snapshot or stats, which cope with add interrupting them and always return
+// values that were all in the window at the same time.
+type buffer struct {
+	buf []uint16
+	// index of the oldest sample, which is the next to be overwritten
+	head uint32
+	// incremented after every add, so readers can tell that they were interrupted
+	seq uint32
+
+	// sum and sum of squares of every sample in buf, kept exactly so they never drift. With 16-bit samples, these (and
+	// the arithmetic in stdDev) don't overflow for windows of up to maxWindow samples.
+	sum   uint32
+	sumSq uint64
+}
+
+const maxWindow = 0xFFFF
+
+// the sample value with no sound
+const silence = 0x8000
+
+// how many times snapshot retries if it was interrupted mid-copy, before settling for fewer samples
+const snapshotRetries = 4
+
+// newBuffer returns a buffer of size samples, initially silent so that the level doesn't start out huge.
+func newBuffer(size int) buffer {
+	b := buffer{
+		buf:   make([]uint16, size),
+		sum:   uint32(size) * silence,
+		sumSq: uint64(size) * silence * silence,
+	}
+	for i := range b.buf {
+		b.buf[i] = silence
+	}
+	return b
+}
+
+// add replaces the oldest sample with v. It must only be called from one place, the sampling interrupt.
+func (b *buffer) add(v uint16) {
+	h := b.head
+	prev := b.buf[h]
+	b.buf[h] = v
+	h++
+	if h == uint32(len(b.buf)) {
+		h = 0
+	}
+	atomic.StoreUint32(&b.head, h)
+
+	b.sum = b.sum + uint32(v) - uint32(prev)
+	b.sumSq = b.sumSq + uint64(v)*uint64(v) - uint64(prev)*uint64(prev)
+	atomic.AddUint32(&b.seq, 1)
+}
+
+// snapshot copies up to len(dst) of the most recent samples into dst, oldest first, and returns how many were copied.
+//
+// If add interrupts the copy, it overwrites the oldest samples, possibly before they were copied. Rather than return
+// those newer samples out of order, snapshot retries, and if it keeps being interrupted, leaves out however many of
+// the oldest samples could have been overwritten. The copy is always of consecutive samples; it may just be short.
+func (b *buffer) snapshot(dst []uint16) int {
+	n := len(dst)
+	if n > len(b.buf) {
+		n = len(b.buf)
+	}
+
+	var got int
+	for try := 0; try <= snapshotRetries; try++ {
+		seq := atomic.LoadUint32(&b.seq)
+		// skip the oldest samples if dst is smaller than the window
+		start := int(atomic.LoadUint32(&b.head)) + len(b.buf) - n
+		for i := 0; i < n; i++ {
+			dst[i] = b.buf[(start+i)%len(b.buf)]
+		}
+		adds := atomic.LoadUint32(&b.seq) - seq
+		if adds == 0 {
+			return n
+		}
+		got = untorn(dst[:n], len(b.buf), adds)
+	}
+	return got
+}
+
+// untorn drops the samples at the start of dst, a copy of the newest len(dst) of size samples, that adds calls to add
+// during the copy could have overwritten, and returns how many are left. add overwrites the oldest samples first, so
+// the first adds-(size-len(dst)) are suspect, and everything after them is untouched.
+func untorn(dst []uint16, size int, adds uint32) int {
+	torn := int64(adds) - int64(size-len(dst))
+	if torn <= 0 {
+		return len(dst)
+	}
+	if torn >= int64(len(dst)) {
+		return 0
+	}
+	return copy(dst, dst[torn:])
+}
+
+// stats returns the sum and sum of squares of the window. sumSq is 64 bits, so reading it isn't atomic; reading the
+// pair takes far less than a sample period, so retrying until add didn't interrupt is quick.
+func (b *buffer) stats() (sum uint32, sumSq uint64) {
+	for {
+		seq := atomic.LoadUint32(&b.seq)
+		sum, sumSq = b.sum, b.sumSq
+		if atomic.LoadUint32(&b.seq) == seq {
+			return sum, sumSq
+		}
+	}
+}
+
+func (b *buffer) stdDev() float64 {
+	sum, sumSq := b.stats()
+	// n²·variance, which is exact in integers: with at most maxWindow 16-bit samples, n·sumSq < 0xFFFF⁴ < 2^64
+	n := uint64(len(b.buf))
+	nSumSq, sq := n*sumSq, uint64(sum)*uint64(sum)
+	// can't be negative for a consistent sum and sumSq, but don't let it wrap around if it ever is
+	if nSumSq <= sq {
+		return 0
+	}
+	return math.Sqrt(float64(nSumSq-sq)) / float64(n)
+}
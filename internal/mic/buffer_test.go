@@ -0,0 +1,220 @@
+package mic
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestBufferSnapshot(t *testing.T) {
+	b := newBuffer(5)
+	for v := uint16(1); v <= 7; v++ {
+		b.add(v)
+	}
+
+	tests := []struct {
+		len  int
+		want []uint16
+	}{
+		{0, []uint16{}},
+		{3, []uint16{5, 6, 7}},
+		{5, []uint16{3, 4, 5, 6, 7}},
+		// no more than the window
+		{8, []uint16{3, 4, 5, 6, 7}},
+	}
+	for _, tt := range tests {
+		dst := make([]uint16, tt.len)
+		n := b.snapshot(dst)
+		if got := dst[:n]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("snapshot into %d: got %v, want %v", tt.len, got, tt.want)
+		}
+	}
+}
+
+func TestUntorn(t *testing.T) {
+	// a copy of the newest 4 of 6 samples, 1 to 6; add overwrites 1, 2, 3... in that order
+	tests := []struct {
+		adds uint32
+		want []uint16
+	}{
+		{0, []uint16{3, 4, 5, 6}},
+		// 1 and 2 aren't in the copy
+		{2, []uint16{3, 4, 5, 6}},
+		{3, []uint16{4, 5, 6}},
+		{5, []uint16{6}},
+		{6, []uint16{}},
+		// lapped entirely
+		{100, []uint16{}},
+		{math.MaxUint32, []uint16{}},
+	}
+	for _, tt := range tests {
+		dst := []uint16{3, 4, 5, 6}
+		n := untorn(dst, 6, tt.adds)
+		if got := dst[:n]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d adds: got %v, want %v", tt.adds, got, tt.want)
+		}
+	}
+}
+
+func TestBufferStats(t *testing.T) {
+	b := newBuffer(4)
+	for _, v := range []uint16{100, 200, 300, 400, 500, 600} {
+		b.add(v)
+	}
+	sum, sumSq := b.stats()
+	if sum != 300+400+500+600 || sumSq != 300*300+400*400+500*500+600*600 {
+		t.Errorf("got %d, %d", sum, sumSq)
+	}
+	// population standard deviation of 300, 400, 500, 600
+	if got, want := b.stdDev(), math.Sqrt(12500); math.Abs(got-want) > 1e-9 {
+		t.Errorf("stdDev = %v, want %v", got, want)
+	}
+}
+
+// shiftBuffer is how samples used to be kept: shifting the whole window on every sample, with a running float32 mean.
+type shiftBuffer struct {
+	buf  []uint16
+	mean float32
+}
+
+func (b *shiftBuffer) add(v uint16) float32 {
+	prev := float32(b.buf[0])
+	copy(b.buf, b.buf[1:])
+	b.buf[len(b.buf)-1] = v
+	b.mean = b.mean + (float32(v)-prev)/float32(len(b.buf))
+	return b.mean
+}
+
+func (b *shiftBuffer) stdDev() float64 {
+	devSum := float64(0)
+	mean := float64(b.mean)
+	for _, vv := range b.buf {
+		dev := float64(vv) - mean
+		devSum += dev * dev
+	}
+	return math.Sqrt(devSum / float64(len(b.buf)))
+}
+
+var benchSizes = []int{256, 1024, 4096}
+
+// The sampling interrupt calls add at the sample rate; stdDev is called about once a frame.
+
+func BenchmarkBufferAdd(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := newBuffer(size)
+			for i := 0; i < b.N; i++ {
+				buf.add(uint16(i))
+			}
+		})
+	}
+}
+
+func BenchmarkShiftBufferAdd(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := shiftBuffer{buf: make([]uint16, size)}
+			for i := 0; i < b.N; i++ {
+				buf.add(uint16(i))
+			}
+		})
+	}
+}
+
+func BenchmarkBufferStdDev(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := newBuffer(size)
+			for i := 0; i < b.N; i++ {
+				buf.stdDev()
+			}
+		})
+	}
+}
+
+func BenchmarkShiftBufferStdDev(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := shiftBuffer{buf: make([]uint16, size)}
+			for i := 0; i < b.N; i++ {
+				buf.stdDev()
+			}
+		})
+	}
+}
+
+// TestBufferNoDrift adds millions of samples and checks that the running sums still match the window exactly.
+func TestBufferNoDrift(t *testing.T) {
+	samples := 5_000_000
+	if testing.Short() {
+		samples = 100_000
+	}
+	// a small deterministic generator, so failures reproduce
+	x := uint32(1)
+	next := func() uint16 {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		return uint16(x)
+	}
+
+	for _, size := range []int{1, 7, 1000, maxWindow} {
+		b := newBuffer(size)
+		for i := 0; i < samples; i++ {
+			b.add(next())
+		}
+
+		var sum uint32
+		var sumSq uint64
+		var mean float64
+		for _, v := range b.buf {
+			sum += uint32(v)
+			sumSq += uint64(v) * uint64(v)
+			mean += float64(v)
+		}
+		if b.sum != sum || b.sumSq != sumSq {
+			t.Errorf("window %d: running sums %d, %d; window has %d, %d", size, b.sum, b.sumSq, sum, sumSq)
+		}
+
+		mean /= float64(size)
+		var dev float64
+		for _, v := range b.buf {
+			dev += (float64(v) - mean) * (float64(v) - mean)
+		}
+		want := math.Sqrt(dev / float64(size))
+		if got := b.stdDev(); math.Abs(got-want) > 1e-6*want+1e-9 {
+			t.Errorf("window %d: stdDev = %v, want %v", size, got, want)
+		}
+	}
+}
+
+// TestBufferExtremes checks the largest window at the largest possible variance, where the sums are closest to
+// overflowing.
+func TestBufferExtremes(t *testing.T) {
+	b := newBuffer(maxWindow)
+	for i := 0; i < maxWindow; i++ {
+		b.add(uint16(0xFFFF * (i & 1)))
+	}
+	// half the samples are 0 and half 0xFFFF, give or take the odd one out
+	want := 0xFFFF / 2.0
+	if got := b.stdDev(); math.Abs(got-want) > 0.01 {
+		t.Errorf("stdDev = %v, want %v", got, want)
+	}
+
+	for i := 0; i < maxWindow; i++ {
+		b.add(0xFFFF)
+	}
+	if got := b.stdDev(); got != 0 {
+		t.Errorf("constant window: stdDev = %v, want 0", got)
+	}
+}
+
+func TestBufferInconsistentStats(t *testing.T) {
+	// as if the sums had been read halfway through an add; the variance mustn't wrap around to something huge
+	b := newBuffer(4)
+	b.sum, b.sumSq = 4*1000, 4*999*999
+	if got := b.stdDev(); got != 0 {
+		t.Errorf("stdDev = %v, want 0", got)
+	}
+}
@@ -0,0 +1,100 @@
+package mic
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+var (
+	ErrNoSamples = errors.New("no samples")
+	ErrTooQuiet  = errors.New("speech too quiet")
+)
+
+// Calibration is VAD thresholds derived from recordings of the room and of the wearer talking.
+type Calibration struct {
+	// Noise and Speech are typical levels of each, for showing to the wearer.
+	Noise, Speech float32
+	// MinLevel, Open and Close are for the VAD's fields of the same names.
+	MinLevel, Open, Close float32
+}
+
+// bounds on the calibrated VAD ratios, so that a very quiet or very loud recording doesn't produce something useless
+const (
+	minOpenRatio  = 1.5
+	maxOpenRatio  = 10
+	minCloseRatio = 1.2
+	// Close is this fraction of Open
+	closeFraction = 0.65
+	// how much louder than the loud end of the noise speech must be to count
+	minSpeechRatio = 1.2
+	// the percentage of the speech recording that must be louder than the noise
+	minVoiced = 20
+)
+
+// Calibrate works out VAD thresholds from levels (from Mic.Value) recorded while the wearer was quiet and while they
+// were talking. Speech must be clearly louder than the noise, or it returns ErrTooQuiet.
+//
+// The minimum level is set between the loud end of the noise and the quiet end of the speech, ignoring the gaps between
+// words, but no further than a factor of √maxOpenRatio below the speech; and the ratios so that the typical noise floor
+// must rise to the minimum level to start talking. Both slices are sorted in place.
+func Calibrate(quiet, speech []float32) (Calibration, error) {
+	if len(quiet) == 0 || len(speech) == 0 {
+		return Calibration{}, ErrNoSamples
+	}
+	sort.Slice(quiet, func(i, j int) bool { return quiet[i] < quiet[j] })
+	sort.Slice(speech, func(i, j int) bool { return speech[i] < speech[j] })
+
+	c := Calibration{
+		Noise:  percentile(quiet, 50),
+		Speech: percentile(speech, 50),
+	}
+	// ignore the gaps between words, which are as quiet as the room
+	loudNoise := percentile(quiet, 95)
+	i := sort.Search(len(speech), func(i int) bool { return speech[i] > loudNoise*minSpeechRatio })
+	voiced := speech[i:]
+	if len(voiced) == 0 || len(voiced) < len(speech)*minVoiced/100 {
+		return c, ErrTooQuiet
+	}
+	quietSpeech := percentile(voiced, 25)
+
+	// geometric mean, as loudness is perceived logarithmically; a dead quiet room would put it at 0, where anything at
+	// all would count as talking, so the noise end is never taken as more than maxOpenRatio below the speech
+	if min := quietSpeech / maxOpenRatio; loudNoise < min {
+		loudNoise = min
+	}
+	c.MinLevel = float32(math.Sqrt(float64(loudNoise * quietSpeech)))
+
+	c.Open = maxOpenRatio
+	if c.Noise > 0 {
+		c.Open = clamp(c.MinLevel/c.Noise, minOpenRatio, maxOpenRatio)
+	}
+	c.Close = clamp(c.Open*closeFraction, minCloseRatio, c.Open)
+	return c, nil
+}
+
+// Apply sets v's thresholds to c's.
+func (c Calibration) Apply(v *VAD) {
+	v.MinLevel = c.MinLevel
+	v.Open = c.Open
+	v.Close = c.Close
+}
+
+// percentile returns the pth percentile of sorted, which must not be empty, using the nearest rank.
+func percentile(sorted []float32, p int) float32 {
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i]
+}
+
+func clamp(v, lo, hi float32) float32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package mic
+
+import (
+	"errors"
+	"testing"
+)
+
+// levels returns n levels spread evenly from lo to hi, in a shuffled order.
+func levels(n int, lo, hi float32) []float32 {
+	l := make([]float32, n)
+	for i := range l {
+		// 7 is coprime with every n used here, so this visits each step once
+		j := (i * 7) % n
+		l[i] = lo + (hi-lo)*float32(j)/float32(n-1)
+	}
+	return l
+}
+
+func TestCalibrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		silence     []float32
+		speech      []float32
+		minLevel    [2]float32
+		open, close float32
+	}{
+		{
+			// quiet room: noise 100-200, speech mostly 2000-6000 with quiet gaps between words
+			name:    "quiet room",
+			silence: levels(300, 100, 200),
+			speech:  append(levels(200, 2000, 6000), levels(100, 100, 200)...),
+			// the noise is so much quieter than the speech that the minimum is set relative to the speech alone
+			minLevel: [2]float32{850, 1000},
+		},
+		{
+			// loud hall: the noise is a lot closer to the speech, so the ratio bottoms out
+			name:     "loud hall",
+			silence:  levels(300, 2000, 3000),
+			speech:   levels(300, 3700, 5000),
+			minLevel: [2]float32{3300, 3600},
+			open:     minOpenRatio, close: minCloseRatio,
+		},
+		{
+			// a silent room with a mic that reads 0
+			name:     "dead quiet",
+			silence:  levels(300, 0, 0),
+			speech:   levels(300, 1000, 4000),
+			minLevel: [2]float32{500, 600},
+			open:     maxOpenRatio, close: maxOpenRatio * closeFraction,
+		},
+	}
+	for _, tt := range tests {
+		c, err := Calibrate(tt.silence, tt.speech)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if c.MinLevel < tt.minLevel[0] || c.MinLevel > tt.minLevel[1] {
+			t.Errorf("%s: MinLevel %v, want %v to %v", tt.name, c.MinLevel, tt.minLevel[0], tt.minLevel[1])
+		}
+		if c.Open < minOpenRatio || c.Open > maxOpenRatio || c.Close < minCloseRatio || c.Close > c.Open {
+			t.Errorf("%s: ratios open %v close %v out of bounds", tt.name, c.Open, c.Close)
+		}
+		if tt.open != 0 && (c.Open != tt.open || c.Close != tt.close) {
+			t.Errorf("%s: ratios open %v close %v, want %v and %v", tt.name, c.Open, c.Close, tt.open, tt.close)
+		}
+		// the typical noise floor, raised by Open, reaches the minimum level
+		if c.Noise > 0 && c.Open < maxOpenRatio && c.Open > minOpenRatio {
+			if d := c.Noise*c.Open - c.MinLevel; d < -1 || d > 1 {
+				t.Errorf("%s: noise %v × open %v = %v, want MinLevel %v", tt.name, c.Noise, c.Open, c.Noise*c.Open, c.MinLevel)
+			}
+		}
+		if c.MinLevel <= c.Noise || c.MinLevel >= c.Speech {
+			t.Errorf("%s: MinLevel %v not between noise %v and speech %v", tt.name, c.MinLevel, c.Noise, c.Speech)
+		}
+	}
+}
+
+func TestCalibrateErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		silence, speech []float32
+		want            error
+	}{
+		{"no silence", nil, levels(10, 1, 2), ErrNoSamples},
+		{"no speech", levels(10, 1, 2), nil, ErrNoSamples},
+		{"speech as loud as the room", levels(300, 1000, 2000), levels(300, 1000, 2000), ErrTooQuiet},
+		// mostly gaps, with only a few loud moments
+		{"too little speech", levels(300, 100, 200), append(levels(290, 100, 200), levels(10, 3000, 4000)...), ErrTooQuiet},
+	}
+	for _, tt := range tests {
+		if _, err := Calibrate(tt.silence, tt.speech); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCalibrationApply(t *testing.T) {
+	v := NewVAD()
+	Calibration{MinLevel: 1234, Open: 3, Close: 2}.Apply(v)
+	if v.MinLevel != 1234 || v.Open != 3 || v.Close != 2 {
+		t.Errorf("got MinLevel %v, Open %v, Close %v", v.MinLevel, v.Open, v.Close)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, tt := range []struct {
+		p    int
+		want float32
+	}{{0, 1}, {10, 1}, {11, 2}, {50, 5}, {95, 10}, {100, 10}} {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile %d = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile([]float32{7}, 50); got != 7 {
+		t.Errorf("percentile of one = %v, want 7", got)
+	}
+}
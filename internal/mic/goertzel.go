@@ -0,0 +1,27 @@
+package mic
+
+import "math"
+
+// goertzel measures the power at one frequency, which is much cheaper than an FFT when only a few frequencies matter.
+type goertzel struct {
+	freq  float32
+	coeff float32
+}
+
+func newGoertzel(freq, rate float32) goertzel {
+	return goertzel{
+		freq:  freq,
+		coeff: float32(2 * math.Cos(2*math.Pi*float64(freq)/float64(rate))),
+	}
+}
+
+// power returns the power at g's frequency in x, normalized by the length of x.
+func (g goertzel) power(x []float32) float32 {
+	var s1, s2 float32
+	for _, v := range x {
+		s := v + g.coeff*s1 - s2
+		s2, s1 = s1, s
+	}
+	n := float32(len(x))
+	return (s1*s1 + s2*s2 - g.coeff*s1*s2) / (n * n)
+}
@@ -0,0 +1,52 @@
+package mic
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// highPass is a first-order DC-blocking filter, y[n] = x[n] - x[n-1] + a·y[n-1], in fixed point so it's cheap enough
+// for the sampling interrupt. It removes the MAX9814's mid-rail offset, along with rumble from fans and handling noise
+// below the cutoff.
+type highPass struct {
+	// the pole, in Q15; 0 passes samples through unfiltered. Set with atomic, since it may change while filtering.
+	a     int32
+	prevX int32
+	// whether prevX is a real sample yet; otherwise the first sample looks like a huge step from 0
+	primed bool
+	// the previous output, in Q8 so that rounding doesn't build up into an offset
+	y int32
+}
+
+// setCutoff sets the -3 dB frequency of the filter, for samples taken at rate Hz. A cutoff of 0 turns the filter off.
+func (h *highPass) setCutoff(hz, rate float32) {
+	var a int32
+	if hz > 0 && rate > 0 {
+		a = int32(math.Exp(-2*math.Pi*float64(hz)/float64(rate))*(1<<15) + 0.5)
+	}
+	atomic.StoreInt32(&h.a, a)
+}
+
+// filter returns the next output for sample v, centered on 0x8000 like the input.
+func (h *highPass) filter(v uint16) uint16 {
+	x := int32(v)
+	if !h.primed {
+		h.prevX, h.primed = x, true
+	}
+	a := atomic.LoadInt32(&h.a)
+	if a == 0 {
+		h.prevX = x
+		return v
+	}
+
+	h.y = (x-h.prevX)<<8 + int32((int64(a)*int64(h.y))>>15)
+	h.prevX = x
+
+	y := h.y>>8 + silence
+	if y < 0 {
+		return 0
+	} else if y > 0xFFFF {
+		return 0xFFFF
+	}
+	return uint16(y)
+}
@@ -0,0 +1,108 @@
+package mic
+
+import (
+	"math"
+	"testing"
+)
+
+// gain filters a sine at freq through a fresh filter with the given cutoff, and returns the ratio of the output's
+// amplitude to the input's once the filter has settled.
+func gain(cutoff, freq float64) float64 {
+	var h highPass
+	h.setCutoff(float32(cutoff), testRate)
+	const amplitude = 8000
+	var in, out float64
+	for i := 0; i < testRate; i++ {
+		x := amplitude * math.Sin(2*math.Pi*freq*float64(i)/testRate)
+		y := float64(h.filter(uint16(silence+math.Round(x)))) - silence
+		// skip the first half second while the filter settles
+		if i >= testRate/2 {
+			in += x * x
+			out += y * y
+		}
+	}
+	return math.Sqrt(out / in)
+}
+
+func TestHighPassResponse(t *testing.T) {
+	tests := []struct {
+		freq     float64
+		min, max float64
+	}{
+		// mains hum and handling rumble
+		{30, 0, 0.25},
+		// -3 dB at the cutoff
+		{testHighPass, 0.68, 0.74},
+		// speech goes through; this form of the filter boosts high frequencies very slightly, by up to 2/(1+a)
+		{1000, 0.98, 1.03},
+		{4000, 0.99, 1.04},
+	}
+	for _, tt := range tests {
+		if g := gain(testHighPass, tt.freq); g < tt.min || g > tt.max {
+			t.Errorf("gain at %v Hz = %.3f, want %.2f to %.2f", tt.freq, g, tt.min, tt.max)
+		}
+	}
+}
+
+func TestHighPassDC(t *testing.T) {
+	// the MAX9814 sits around mid-rail, but not exactly on it
+	for _, dc := range []uint16{silence, silence + 3000, silence - 5000, 0, 0xFFFF} {
+		var h highPass
+		h.setCutoff(testHighPass, testRate)
+		// the first sample isn't a step from 0, so there is no transient at all
+		if y := h.filter(dc); y != silence {
+			t.Errorf("DC %#04x: first output %#04x, want %#04x", dc, y, silence)
+		}
+		for i := 0; i < testRate; i++ {
+			if y := h.filter(dc); y != silence {
+				t.Fatalf("DC %#04x: output %#04x after %d samples, want %#04x", dc, y, i+1, silence)
+			}
+		}
+	}
+}
+
+func TestHighPassOffset(t *testing.T) {
+	// rounding mustn't build up into an offset; the mean of a filtered sine should stay at silence
+	var h highPass
+	h.setCutoff(testHighPass, testRate)
+	var sum float64
+	const n = 10 * testRate
+	for i := 0; i < n; i++ {
+		x := 0x1000 + 300*math.Sin(2*math.Pi*440*float64(i)/testRate)
+		sum += float64(h.filter(uint16(x))) - silence
+	}
+	if mean := sum / n; math.Abs(mean) > 1 {
+		t.Errorf("mean output %+.2f from silence", mean)
+	}
+}
+
+func TestHighPassOff(t *testing.T) {
+	var h highPass
+	for _, v := range []uint16{0x1234, 0, 0xFFFF, 0x8000} {
+		if y := h.filter(v); y != v {
+			t.Errorf("off: filter(%#04x) = %#04x", v, y)
+		}
+	}
+
+	// turning it on part way through doesn't see a step from whatever came before
+	h.setCutoff(testHighPass, testRate)
+	if y := h.filter(0x8000); y != silence {
+		t.Errorf("after turning on: %#04x, want %#04x", y, silence)
+	}
+}
+
+func TestHighPassClips(t *testing.T) {
+	var h highPass
+	h.setCutoff(testHighPass, testRate)
+	h.filter(0)
+	if y := h.filter(0xFFFF); y != 0xFFFF {
+		t.Errorf("full-scale step up: %#04x, want 0xffff", y)
+	}
+	// settle back to silence, then step the other way
+	for i := 0; i < testRate; i++ {
+		h.filter(0xFFFF)
+	}
+	if y := h.filter(0); y != 0 {
+		t.Errorf("full-scale step down: %#04x, want 0", y)
+	}
+}
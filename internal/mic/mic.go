@@ -1,98 +1,79 @@
+// Package mic measures how loud an analog microphone is.
+//
+// Samples come from a SampleSource: on the badge that's an ADCSource reading the SAMD51's ADC from a timer interrupt,
+// and off-target it's a recording, so the signal processing can be tuned against real speech.
 package mic
 
-import (
-	"device/sam"
-	"machine"
-	"math"
-	"runtime/interrupt"
-)
+import "time"
 
-type Mic struct {
-	adc machine.ADC
-	buf buffer
+// SampleSource produces samples at a fixed rate. Samples are 16 bits, however many the ADC has, so silence is around
+// 0x8000.
+type SampleSource interface {
+	// Start begins delivering samples to sink, which may be called from an interrupt handler.
+	Start(sink func(v uint16))
+	// SampleRate returns the rate samples are delivered at, in Hz.
+	SampleRate() float32
 }
 
-var instance *Mic
-
-type buffer struct {
-	buf  []uint16
-	mean float32
+type Mic struct {
+	src SampleSource
+	hp  highPass
+	buf buffer
+	rec recorder
 }
 
-// New creates a new mic driver for the specified analog pin.
-// Creating more than one Mic is not allowed.
-func New(pin machine.Pin, bufSize uint16) *Mic {
-	if instance != nil {
-		panic("cannot create more than one microphone driver")
+// New creates a mic driver that measures the level over the most recent window of samples from src, and starts src.
+func New(src SampleSource, window time.Duration) *Mic {
+	size := int(float64(src.SampleRate())*window.Seconds() + 0.5)
+	if size < 1 {
+		size = 1
+	} else if size > maxWindow {
+		size = maxWindow
 	}
-
-	adc := machine.ADC{Pin: pin}
-	adc.Configure(machine.ADCConfig{
-		Resolution: 12,
-		Samples:    1,
-	})
-	sam.ADC0.SetCTRLB_FREERUN(1)
-
 	m := &Mic{
-		adc: adc,
-		buf: buffer{
-			buf: make([]uint16, bufSize),
-		},
-	}
-	instance = m
-
-	i := interrupt.New(sam.IRQ_TC0, irq)
-	i.Enable()
-
-	// configure timer
-	sam.MCLK.SetAPBAMASK_TC0_(1)
-	sam.GCLK.PCHCTRL[sam.PCHCTRL_GCLK_TC0].Set(sam.GCLK_PCHCTRL_GEN_GCLK1 | 1<<sam.GCLK_PCHCTRL_CHEN_Pos)
-	for sam.GCLK.SYNCBUSY.Get() != 0 {
+		src: src,
+		buf: newBuffer(size),
 	}
+	src.Start(m.add)
+	return m
+}
 
-	tc := sam.TC0_COUNT16
-	tc.SetCTRLA_ENABLE(0)
-	tc.WAVE.Set(sam.TC_COUNT16_WAVE_WAVEGEN_MFRQ)
-	for tc.SYNCBUSY.Get() != 0 {
-	}
-	// enable interrupt
-	tc.SetINTENSET_MC0(1)
-	tc.CC[0].Set(0xFFFF)
-
-	// start timer
-	tc.CC[0].Set(3072)
-	for tc.SYNCBUSY.HasBits(sam.TC_COUNT16_SYNCBUSY_CC0 | sam.TC_COUNT16_SYNCBUSY_CC1) {
-	}
-	tc.SetCTRLA_ENABLE(1)
+// SetHighPass filters out frequencies below hz before measuring the level. 0 turns the filter off, which is the
+// default.
+func (m *Mic) SetHighPass(hz float32) {
+	m.hp.setCutoff(hz, m.src.SampleRate())
+}
 
-	return m
+// add is the sink for the source.
+func (m *Mic) add(v uint16) {
+	m.rec.add(v)
+	m.buf.add(m.hp.filter(v))
 }
 
+// Value returns the standard deviation of the samples in the window, i.e. the AC amplitude.
 func (m *Mic) Value() float32 {
 	return float32(m.buf.stdDev())
 }
 
-func irq(_ interrupt.Interrupt) {
-	v := instance.adc.Get()
-	instance.buf.add(v)
-	sam.TC0_COUNT16.SetINTFLAG_MC0(1)
+// SampleRate returns the rate samples are actually taken at, in Hz.
+func (m *Mic) SampleRate() float32 {
+	return m.src.SampleRate()
 }
 
-func (b *buffer) add(v uint16) float32 {
-	prev := float32(b.buf[0])
-	copy(b.buf, b.buf[1:])
-	b.buf[len(b.buf)-1] = v
-	b.mean = b.mean + (float32(v)-prev)/float32(len(b.buf))
-	return b.mean
+// Window returns how long the window is. It's rounded to a whole number of samples, so it may be slightly different
+// from what was asked for.
+func (m *Mic) Window() time.Duration {
+	return time.Duration(float64(len(m.buf.buf)) / float64(m.src.SampleRate()) * float64(time.Second))
 }
 
-func (b *buffer) stdDev() float64 {
-	devSum := float64(0)
-	mean := float64(b.mean)
-	for _, vv := range b.buf {
-		dev := float64(vv) - mean
-		devSum += dev * dev
-	}
+// Size returns the number of samples in the window.
+func (m *Mic) Size() int {
+	return len(m.buf.buf)
+}
 
-	return math.Sqrt(devSum / float64(len(b.buf)))
+// Snapshot copies the most recent samples into dst, oldest first, and returns how many were copied. It is safe to call
+// while sampling continues; if sampling keeps interrupting the copy, fewer samples than asked for may be returned, but
+// they are always consecutive.
+func (m *Mic) Snapshot(dst []uint16) int {
+	return m.buf.snapshot(dst)
 }
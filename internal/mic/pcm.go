@@ -0,0 +1,167 @@
+package mic
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotWAV    = errors.New("not a wav file")
+	ErrWAVFormat = errors.New("unsupported wav format")
+)
+
+// PCMSource plays back recorded samples. Nothing happens on its own; call Advance to deliver samples.
+type PCMSource struct {
+	Samples []uint16
+	Rate    float32
+
+	sink func(uint16)
+	pos  int
+}
+
+// SampleRate implements SampleSource.
+func (p *PCMSource) SampleRate() float32 {
+	return p.Rate
+}
+
+// Start implements SampleSource.
+func (p *PCMSource) Start(sink func(v uint16)) {
+	p.sink = sink
+}
+
+// Advance delivers up to n samples to the sink, and returns how many it delivered. It returns 0 once every sample has
+// been delivered.
+func (p *PCMSource) Advance(n int) int {
+	if n > len(p.Samples)-p.pos {
+		n = len(p.Samples) - p.pos
+	}
+	for _, v := range p.Samples[p.pos : p.pos+n] {
+		p.sink(v)
+	}
+	p.pos += n
+	return n
+}
+
+// WAVWriter writes samples as a 16-bit mono WAV file.
+type WAVWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewWAVWriter writes the header for a WAV file of the given number of samples taken at rate Hz. The header can't be
+// fixed up afterwards, so exactly that many samples must then be written.
+func NewWAVWriter(w io.Writer, rate float32, samples int) (*WAVWriter, error) {
+	size := uint32(samples) * 2
+	r := uint32(rate + 0.5)
+
+	h := make([]byte, 0, 44)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, 36+size)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	// PCM, mono
+	h = binary.LittleEndian.AppendUint16(h, 1)
+	h = binary.LittleEndian.AppendUint16(h, 1)
+	h = binary.LittleEndian.AppendUint32(h, r)
+	// bytes per second, bytes per frame, bits per sample
+	h = binary.LittleEndian.AppendUint32(h, r*2)
+	h = binary.LittleEndian.AppendUint16(h, 2)
+	h = binary.LittleEndian.AppendUint16(h, 16)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, size)
+
+	if _, err := w.Write(h); err != nil {
+		return nil, err
+	}
+	return &WAVWriter{w: w}, nil
+}
+
+// Write writes samples.
+func (ww *WAVWriter) Write(samples []uint16) error {
+	ww.buf = ww.buf[:0]
+	for _, v := range samples {
+		// WAV's 16-bit samples are signed
+		ww.buf = binary.LittleEndian.AppendUint16(ww.buf, v^0x8000)
+	}
+	_, err := ww.w.Write(ww.buf)
+	return err
+}
+
+// ReadWAV reads an uncompressed 8- or 16-bit WAV file. Only the first channel is kept, and samples are scaled to 16
+// bits.
+func ReadWAV(r io.Reader) (*PCMSource, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, ErrNotWAV
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	var channels, bits uint16
+	var rate uint32
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, ErrNotWAV
+		}
+		size := binary.LittleEndian.Uint32(chunk[4:])
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrNotWAV
+			}
+			f := make([]byte, size+size&1)
+			if _, err := io.ReadFull(r, f); err != nil {
+				return nil, ErrNotWAV
+			}
+			// 1 is plain PCM
+			if binary.LittleEndian.Uint16(f[0:]) != 1 {
+				return nil, ErrWAVFormat
+			}
+			channels = binary.LittleEndian.Uint16(f[2:])
+			rate = binary.LittleEndian.Uint32(f[4:])
+			bits = binary.LittleEndian.Uint16(f[14:])
+			if channels == 0 || (bits != 8 && bits != 16) {
+				return nil, ErrWAVFormat
+			}
+
+		case "data":
+			if channels == 0 {
+				return nil, ErrNotWAV
+			}
+			data := make([]byte, size)
+			n, err := io.ReadFull(r, data)
+			// tolerate a truncated recording
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+			return &PCMSource{
+				Samples: decodePCM(data[:n], int(channels), int(bits)),
+				Rate:    float32(rate),
+			}, nil
+
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(size+size&1)); err != nil {
+				return nil, ErrNotWAV
+			}
+		}
+	}
+}
+
+func decodePCM(data []byte, channels, bits int) []uint16 {
+	frame := channels * bits / 8
+	samples := make([]uint16, len(data)/frame)
+	for i := range samples {
+		f := data[i*frame:]
+		if bits == 8 {
+			// 8-bit samples are unsigned
+			samples[i] = uint16(f[0]) << 8
+		} else {
+			samples[i] = binary.LittleEndian.Uint16(f) ^ 0x8000
+		}
+	}
+	return samples
+}
@@ -0,0 +1,164 @@
+package mic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// wav builds a WAV file with the given format fields around data. extra chunks go between fmt and data.
+func wav(format, channels uint16, rate uint32, bits uint16, data []byte, extra ...[]byte) []byte {
+	var b []byte
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, 0) // nothing checks this
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, format)
+	b = binary.LittleEndian.AppendUint16(b, channels)
+	b = binary.LittleEndian.AppendUint32(b, rate)
+	frame := uint32(channels) * uint32(bits) / 8
+	b = binary.LittleEndian.AppendUint32(b, rate*frame)
+	b = binary.LittleEndian.AppendUint16(b, uint16(frame))
+	b = binary.LittleEndian.AppendUint16(b, bits)
+	for _, e := range extra {
+		b = append(b, e...)
+	}
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestReadWAV(t *testing.T) {
+	// an odd-sized chunk is followed by a padding byte
+	list := append([]byte("LIST\x03\x00\x00\x00abc"), 0)
+
+	tests := []struct {
+		name     string
+		channels uint16
+		bits     uint16
+		data     []byte
+		extra    [][]byte
+		want     []uint16
+	}{
+		{
+			name: "8-bit", channels: 1, bits: 8,
+			data: []byte{0x80, 0x00, 0xFF, 0x81},
+			want: []uint16{0x8000, 0x0000, 0xFF00, 0x8100},
+		},
+		{
+			// signed, so 0 is silence
+			name: "16-bit", channels: 1, bits: 16,
+			data: []byte{0x00, 0x00, 0x00, 0x80, 0xFF, 0x7F, 0xFF, 0xFF},
+			want: []uint16{0x8000, 0x0000, 0xFFFF, 0x7FFF},
+		},
+		{
+			name: "stereo keeps the first channel", channels: 2, bits: 16,
+			data: []byte{0x10, 0x00, 0xAA, 0xAA, 0x20, 0x00, 0xBB, 0xBB},
+			want: []uint16{0x8010, 0x8020},
+		},
+		{
+			name: "other chunks skipped", channels: 1, bits: 8,
+			data:  []byte{0x40},
+			extra: [][]byte{list},
+			want:  []uint16{0x4000},
+		},
+		{
+			name: "partial frame dropped", channels: 1, bits: 16,
+			data: []byte{0x00, 0x00, 0x01},
+			want: []uint16{0x8000},
+		},
+	}
+	for _, tt := range tests {
+		p, err := ReadWAV(bytes.NewReader(wav(1, tt.channels, 8000, tt.bits, tt.data, tt.extra...)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.Samples, tt.want) || p.Rate != 8000 {
+			t.Errorf("%s: got %#04x at %v Hz, want %#04x at 8000 Hz", tt.name, p.Samples, p.Rate, tt.want)
+		}
+	}
+}
+
+func TestReadWAVTruncated(t *testing.T) {
+	b := wav(1, 1, 8000, 8, []byte{1, 2, 3, 4})
+	p, err := ReadWAV(bytes.NewReader(b[:len(b)-2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x0100, 0x0200}; !reflect.DeepEqual(p.Samples, want) {
+		t.Errorf("got %#04x, want %#04x", p.Samples, want)
+	}
+}
+
+func TestReadWAVErrors(t *testing.T) {
+	good := wav(1, 1, 8000, 16, []byte{0, 0})
+	noFmt := append([]byte("RIFF\x00\x00\x00\x00WAVE"), "data\x02\x00\x00\x00\x00\x00"...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotWAV},
+		{"not riff", append([]byte("RIFX"), good[4:]...), ErrNotWAV},
+		{"no data", good[:36], ErrNotWAV},
+		{"data before fmt", noFmt, ErrNotWAV},
+		{"float", wav(3, 1, 8000, 32, []byte{0, 0, 0, 0}), ErrWAVFormat},
+		{"24-bit", wav(1, 1, 8000, 24, []byte{0, 0, 0}), ErrWAVFormat},
+		{"no channels", wav(1, 0, 8000, 16, nil), ErrWAVFormat},
+	}
+	for _, tt := range tests {
+		if _, err := ReadWAV(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	samples := []uint16{0x8000, 0, 0xFFFF, 0x1234, 0x8001, 0x7FFF}
+
+	var b bytes.Buffer
+	w, err := NewWAVWriter(&b, 15625.4, len(samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// in more than one piece, as the recorder does
+	if err := w.Write(samples[:4]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(samples[4:]); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 44+2*len(samples) {
+		t.Errorf("wrote %d bytes, want %d", b.Len(), 44+2*len(samples))
+	}
+	if size := binary.LittleEndian.Uint32(b.Bytes()[4:]); size != uint32(b.Len()-8) {
+		t.Errorf("RIFF size %d, want %d", size, b.Len()-8)
+	}
+
+	p, err := ReadWAV(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Samples, samples) || p.Rate != 15625 {
+		t.Errorf("got %#04x at %v Hz, want %#04x at 15625 Hz", p.Samples, p.Rate, samples)
+	}
+}
+
+func TestPCMSource(t *testing.T) {
+	p := &PCMSource{Samples: []uint16{1, 2, 3, 4, 5}, Rate: 1000}
+	var got []uint16
+	p.Start(func(v uint16) { got = append(got, v) })
+
+	for _, tt := range []struct{ n, want int }{{2, 2}, {0, 0}, {10, 3}, {1, 0}} {
+		if n := p.Advance(tt.n); n != tt.want {
+			t.Errorf("Advance(%d) = %d, want %d", tt.n, n, tt.want)
+		}
+	}
+	if !reflect.DeepEqual(got, p.Samples) {
+		t.Errorf("delivered %v, want %v", got, p.Samples)
+	}
+}
@@ -0,0 +1,83 @@
+package mic
+
+import "sync/atomic"
+
+// recorder captures raw samples for saving, through a ring that the sampling interrupt fills and the reader drains.
+// Unlike buffer, nothing is overwritten; if the reader falls behind, new samples are dropped and counted, and replaced
+// with silence once there is room again, so that the rest of the recording stays in time.
+type recorder struct {
+	ring []uint16
+	// samples written and read since recording started; only the interrupt writes written, and only the reader writes
+	// read
+	written, read uint32
+	// samples still to capture; 0 when not recording
+	want    uint32
+	dropped uint32
+	// dropped samples not yet replaced with silence; only the interrupt uses it
+	gap uint32
+}
+
+func (r *recorder) add(v uint16) {
+	if atomic.LoadUint32(&r.want) == 0 {
+		return
+	}
+	w := r.written
+	free := uint32(len(r.ring)) - (w - atomic.LoadUint32(&r.read))
+	// the reader makes room a chunk at a time, so this is bounded by the chunk size
+	for ; r.gap > 0 && free > 0; r.gap-- {
+		r.ring[w%uint32(len(r.ring))] = silence
+		w++
+		free--
+	}
+	if free > 0 {
+		r.ring[w%uint32(len(r.ring))] = v
+		w++
+	} else {
+		r.gap++
+		atomic.AddUint32(&r.dropped, 1)
+	}
+	atomic.StoreUint32(&r.written, w)
+	atomic.AddUint32(&r.want, ^uint32(0))
+}
+
+// Record starts capturing the next n samples, before any filtering, through ring. The caller must then drain them
+// with ReadRecording, often enough that ring doesn't fill up.
+func (m *Mic) Record(n int, ring []uint16) {
+	r := &m.rec
+	atomic.StoreUint32(&r.want, 0)
+	r.ring = ring
+	r.written, r.read, r.dropped, r.gap = 0, 0, 0, 0
+	atomic.StoreUint32(&r.want, uint32(n))
+}
+
+// StopRecording stops capturing early.
+func (m *Mic) StopRecording() {
+	atomic.StoreUint32(&m.rec.want, 0)
+}
+
+// ReadRecording copies captured samples into dst, and returns how many it copied, and whether the recording is
+// finished and every sample has been read. Samples dropped at the very end, after which there was never room for their
+// silence, are not returned, so the total read may be short of what was asked for by up to Dropped.
+func (m *Mic) ReadRecording(dst []uint16) (int, bool) {
+	r := &m.rec
+	// check before reading written, so that a sample captured in between isn't missed
+	finished := atomic.LoadUint32(&r.want) == 0
+	w := atomic.LoadUint32(&r.written)
+	rd := r.read
+
+	n := w - rd
+	if n > uint32(len(dst)) {
+		n = uint32(len(dst))
+	}
+	for i := uint32(0); i < n; i++ {
+		dst[i] = r.ring[(rd+i)%uint32(len(r.ring))]
+	}
+	atomic.StoreUint32(&r.read, rd+n)
+	return int(n), finished && rd+n == w
+}
+
+// Dropped returns how many samples of the current or last recording were lost because they weren't read in time, and
+// replaced with silence.
+func (m *Mic) Dropped() int {
+	return int(atomic.LoadUint32(&m.rec.dropped))
+}
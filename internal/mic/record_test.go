@@ -0,0 +1,114 @@
+package mic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recording returns a Mic playing back 1, 2, 3... and the source to advance it with.
+func recording(n int) (*Mic, *PCMSource) {
+	src := &PCMSource{Samples: make([]uint16, n), Rate: testRate}
+	for i := range src.Samples {
+		src.Samples[i] = uint16(i + 1)
+	}
+	return New(src, testWindow), src
+}
+
+func TestRecord(t *testing.T) {
+	m, src := recording(20)
+	// before recording starts
+	src.Advance(2)
+
+	m.Record(10, make([]uint16, 4))
+	var got []uint16
+	chunk := make([]uint16, 3)
+	for {
+		src.Advance(1)
+		n, done := m.ReadRecording(chunk)
+		got = append(got, chunk[:n]...)
+		if done {
+			break
+		}
+	}
+	if want := []uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 12}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if d := m.Dropped(); d != 0 {
+		t.Errorf("dropped %d", d)
+	}
+
+	// nothing more is captured afterwards
+	src.Advance(5)
+	if n, done := m.ReadRecording(chunk); n != 0 || !done {
+		t.Errorf("after the end: read %d, done %v", n, done)
+	}
+}
+
+func TestRecordDropped(t *testing.T) {
+	m, src := recording(20)
+	m.Record(12, make([]uint16, 4))
+	chunk := make([]uint16, 3)
+	var got []uint16
+	read := func() {
+		n, _ := m.ReadRecording(chunk)
+		got = append(got, chunk[:n]...)
+	}
+
+	// 1-4 fill the ring, and 5-7 are dropped
+	src.Advance(7)
+	read()
+	// there's room for 3 again, which the silence for 5-7 takes, so 8 is dropped too
+	src.Advance(1)
+	read()
+	read()
+	// silence for 8, then 9-12 are kept
+	src.Advance(2)
+	read()
+	src.Advance(2)
+	read()
+
+	want := []uint16{1, 2, 3, 4, silence, silence, silence, silence, 9, 10, 11, 12}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if d := m.Dropped(); d != 4 {
+		t.Errorf("dropped %d, want 4", d)
+	}
+}
+
+func TestRecordDroppedAtEnd(t *testing.T) {
+	m, src := recording(20)
+	m.Record(6, make([]uint16, 4))
+	src.Advance(20)
+
+	var got []uint16
+	chunk := make([]uint16, 8)
+	for {
+		n, done := m.ReadRecording(chunk)
+		got = append(got, chunk[:n]...)
+		if done {
+			break
+		}
+	}
+	// the last two never had room; the caller pads them out
+	if want := []uint16{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if d := m.Dropped(); d != 2 {
+		t.Errorf("dropped %d, want 2", d)
+	}
+}
+
+func TestStopRecording(t *testing.T) {
+	m, src := recording(20)
+	m.Record(10, make([]uint16, 16))
+	src.Advance(3)
+	m.StopRecording()
+	src.Advance(3)
+
+	chunk := make([]uint16, 16)
+	n, done := m.ReadRecording(chunk)
+	if want := []uint16{1, 2, 3}; !reflect.DeepEqual(chunk[:n], want) || !done {
+		t.Errorf("got %v, done %v; want %v, done", chunk[:n], done, want)
+	}
+}
@@ -0,0 +1,132 @@
+package mic
+
+import (
+	"math"
+	"time"
+)
+
+// VAD (voice activity detection) decides whether the wearer is talking from a series of levels, such as Mic.Value.
+// Rather than a fixed threshold it tracks the ambient noise floor and looks for levels well above it, so it works in a
+// quiet room and a loud convention hall alike. Separate thresholds for opening and closing, and a hold time, stop the
+// mouth flickering when the level hovers around the threshold.
+//
+// While talking, it also follows how loud the wearer is, as an openness from 1 to 255 for mouths that open
+// proportionally. Openness is 0 exactly when not talking.
+type VAD struct {
+	// Open is how many times the noise floor the level must reach to start talking, and Close is how many times the
+	// floor it must stay above to keep talking. Close should be less than Open.
+	Open, Close float32
+	// MinLevel is the quietest level that starts talking, however quiet the room. The close threshold is scaled down
+	// from it like from the floor.
+	MinLevel float32
+	// Hold is how long talking continues after the level falls below the close threshold, to bridge gaps between words.
+	Hold time.Duration
+	// FloorFall and FloorRise are time constants for the noise floor following the level down and up. The floor falls
+	// quickly so it finds the gaps between words, and rises slowly so speech doesn't drag it up.
+	FloorFall, FloorRise time.Duration
+	// Range is how many times the close threshold the level must reach to open the mouth fully.
+	Range float32
+	// Attack and Release are time constants for the openness following the level up and down.
+	Attack, Release time.Duration
+
+	floor     float32
+	talking   bool
+	openness  float32
+	last      time.Time
+	heldUntil time.Time
+}
+
+// NewVAD returns a VAD with defaults that suit the MAX9814 inside a helmet.
+func NewVAD() *VAD {
+	return &VAD{
+		Open:      2.5,
+		Close:     1.6,
+		Hold:      150 * time.Millisecond,
+		FloorFall: 250 * time.Millisecond,
+		FloorRise: 8 * time.Second,
+		Range:     6,
+		Attack:    20 * time.Millisecond,
+		Release:   80 * time.Millisecond,
+	}
+}
+
+// Update feeds the level measured at now, and returns whether the wearer is talking.
+func (v *VAD) Update(level float32, now time.Time) bool {
+	if v.last.IsZero() {
+		v.floor = level
+	} else {
+		tau := v.FloorRise
+		if level < v.floor {
+			tau = v.FloorFall
+		}
+		v.floor += (level - v.floor) * smoothing(now.Sub(v.last), tau)
+	}
+	dt := now.Sub(v.last)
+	v.last = now
+
+	open := v.floor * v.Open
+	if open < v.MinLevel {
+		open = v.MinLevel
+	}
+	closeAt := open * v.Close / v.Open
+
+	switch {
+	case level >= open, v.talking && level >= closeAt:
+		v.talking = true
+		v.heldUntil = now.Add(v.Hold)
+	case v.talking && now.After(v.heldUntil):
+		v.talking = false
+	}
+
+	if !v.talking {
+		v.openness = 0
+		return false
+	}
+	// loudness is perceived logarithmically, so scale the ratio to the close threshold that way
+	target := float32(0)
+	if level > closeAt && v.Range > 1 {
+		target = 255 * float32(math.Log(float64(level/closeAt))/math.Log(float64(v.Range)))
+		if target > 255 {
+			target = 255
+		}
+	}
+	tau := v.Attack
+	if target < v.openness {
+		tau = v.Release
+	}
+	v.openness += (target - v.openness) * smoothing(dt, tau)
+	return true
+}
+
+// Talking returns the result of the last Update.
+func (v *VAD) Talking() bool {
+	return v.talking
+}
+
+// Openness returns how far open the mouth should be as of the last Update, from 0 to 255. It is never 0 while talking.
+func (v *VAD) Openness() uint8 {
+	if !v.talking {
+		return 0
+	}
+	if v.openness < 1 {
+		return 1
+	}
+	return uint8(v.openness + 0.5)
+}
+
+// Floor returns the current estimate of the ambient noise level.
+func (v *VAD) Floor() float32 {
+	return v.floor
+}
+
+// smoothing returns the weight of a new value in an exponential moving average with time constant tau, dt after the
+// previous value.
+func smoothing(dt, tau time.Duration) float32 {
+	if tau <= 0 || dt >= 20*tau {
+		return 1
+	}
+	if dt <= 0 {
+		return 0
+	}
+	return float32(1 - math.Exp(-float64(dt)/float64(tau)))
+}
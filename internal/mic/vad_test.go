@@ -0,0 +1,310 @@
+package mic
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// as on the badge
+const (
+	testRate      = 15625
+	testWindow    = 16 * time.Millisecond
+	testHighPass  = 150
+	testUpdate    = 5 * time.Millisecond
+	testTalkLevel = 3000
+)
+
+// noise returns a deterministic generator of roughly Gaussian noise with standard deviation std.
+func noise(std float64) func() float64 {
+	x := uint32(2463534242)
+	return func() float64 {
+		// the sum of 4 uniform values, each with variance 1/12
+		var s float64
+		for i := 0; i < 4; i++ {
+			x ^= x << 13
+			x ^= x >> 17
+			x ^= x << 5
+			s += float64(x)/math.MaxUint32 - 0.5
+		}
+		return s * std * math.Sqrt(3)
+	}
+}
+
+// segment is a stretch of a synthetic recording: background noise, with or without the wearer talking over it.
+type segment struct {
+	d       time.Duration
+	talking bool
+}
+
+// scene renders segments as samples. The background is noise plus a babble of tones that drift in level; speech is
+// a voiced sound with a syllable-rate envelope.
+func scene(segs []segment, noiseStd, babble, speech float64) []uint16 {
+	n := noise(noiseStd)
+	var samples []uint16
+	i := 0
+	for _, s := range segs {
+		start := i
+		end := i + int(s.d.Seconds()*testRate)
+		for ; i < end; i++ {
+			t := float64(i) / testRate
+			v := n()
+			// other people talking nearby, rising and falling slowly
+			v += babble * (0.7 + 0.3*math.Sin(2*math.Pi*0.3*t)) * (math.Sin(2*math.Pi*230*t) + math.Sin(2*math.Pi*410*t+1)) / 2
+			if s.talking {
+				// syllables at 4 Hz, starting at full strength
+				env := 0.75 + 0.25*math.Cos(2*math.Pi*4*float64(i-start)/testRate)
+				v += speech * env * (math.Sin(2*math.Pi*180*t) + 0.5*math.Sin(2*math.Pi*360*t) + 0.3*math.Sin(2*math.Pi*900*t))
+			}
+			v += silence
+			if v < 0 {
+				v = 0
+			} else if v > 0xFFFF {
+				v = 0xFFFF
+			}
+			samples = append(samples, uint16(v))
+		}
+	}
+	return samples
+}
+
+// listen plays samples through a Mic set up like the badge's, updating vad every testUpdate, and returns whether it
+// said talking at each update.
+func listen(samples []uint16, vad *VAD) []bool {
+	src := &PCMSource{Samples: samples, Rate: testRate}
+	m := New(src, testWindow)
+	m.SetHighPass(testHighPass)
+
+	var talking []bool
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := int(testUpdate.Seconds() * testRate)
+	for src.Advance(step) == step {
+		now = now.Add(testUpdate)
+		talking = append(talking, vad.Update(m.Value(), now))
+	}
+	return talking
+}
+
+// span is a stretch of time within a scene.
+type span struct {
+	start, end time.Duration
+}
+
+func TestVADScenes(t *testing.T) {
+	// a sentence: words with short gaps between them, which the hold time should bridge
+	sentence := []segment{
+		{400 * time.Millisecond, true},
+		{90 * time.Millisecond, false},
+		{300 * time.Millisecond, true},
+		{120 * time.Millisecond, false},
+		{500 * time.Millisecond, true},
+	}
+	var segs []segment
+	// the floor starts out at the first level, which is mostly of the silence the mic starts with, so it takes a few
+	// seconds to rise to a loud room; nothing is checked until then
+	settle := 3 * time.Second
+	segs = append(segs, segment{settle, false})
+	segs = append(segs, sentence...)
+	segs = append(segs, segment{2 * time.Second, false})
+	segs = append(segs, sentence...)
+	segs = append(segs, segment{2 * time.Second, false})
+
+	// when each sentence starts and ends
+	var sentences []span
+	var at time.Duration
+	for _, s := range segs {
+		if s.talking {
+			if n := len(sentences); n > 0 && at-sentences[n-1].end < time.Second {
+				sentences[n-1].end = at + s.d
+			} else {
+				sentences = append(sentences, span{at, at + s.d})
+			}
+		}
+		at += s.d
+	}
+
+	tests := []struct {
+		name                  string
+		noise, babble, speech float64
+	}{
+		{name: "quiet room", noise: 60, speech: 8000},
+		{name: "convention hall", noise: 900, babble: 2000, speech: 9000},
+		// nobody talking, but often loud enough that the old fixed cutoff would have been talking
+		{name: "convention hall, silent", noise: 900, babble: 8000},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			vad := NewVAD()
+			vad.MinLevel = testTalkLevel
+			talking := listen(scene(segs, tt.noise, tt.babble, tt.speech), vad)
+
+			var got []span
+			for i, on := range talking {
+				at := time.Duration(i+1) * testUpdate
+				switch {
+				case at < settle:
+				case on && (len(got) == 0 || !talking[i-1]):
+					got = append(got, span{at, at})
+				case on:
+					got[len(got)-1].end = at
+				}
+			}
+
+			want := sentences
+			if tt.speech == 0 {
+				want = nil
+			}
+			if len(got) != len(want) {
+				t.Fatalf("talking during %v, want %v", got, want)
+			}
+			for i, w := range want {
+				g := got[i]
+				// a window late at most, or after the hold time, a couple of windows for the level to die away
+				if g.start < w.start || g.start > w.start+testWindow+testUpdate {
+					t.Errorf("sentence %d: started talking at %v, want %v", i, g.start, w.start)
+				}
+				if g.end < w.end || g.end > w.end+vad.Hold+2*testWindow {
+					t.Errorf("sentence %d: stopped talking at %v, want %v", i, g.end, w.end)
+				}
+			}
+		})
+	}
+}
+
+func TestVADHysteresis(t *testing.T) {
+	v := NewVAD()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := func(level float32, d time.Duration) bool {
+		var talking bool
+		for end := now.Add(d); now.Before(end); {
+			now = now.Add(testUpdate)
+			talking = v.Update(level, now)
+		}
+		return talking
+	}
+
+	if step(100, 5*time.Second) {
+		t.Fatal("talking in silence")
+	}
+	floor := v.Floor()
+	if floor < 99 || floor > 101 {
+		t.Fatalf("floor %v, want 100", floor)
+	}
+
+	tests := []struct {
+		level float32
+		d     time.Duration
+		want  bool
+	}{
+		// just under the open threshold
+		{240, 100 * time.Millisecond, false},
+		{260, 10 * time.Millisecond, true},
+		// between the thresholds stays talking, however long
+		{200, 500 * time.Millisecond, true},
+		// below close, but within the hold time
+		{120, 100 * time.Millisecond, true},
+		{120, 100 * time.Millisecond, false},
+		// between the thresholds doesn't start talking again
+		{200, 100 * time.Millisecond, false},
+	}
+	for i, tt := range tests {
+		if got := step(tt.level, tt.d); got != tt.want {
+			t.Errorf("step %d: level %v for %v: talking %v, want %v", i, tt.level, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestVADMinLevel(t *testing.T) {
+	v := NewVAD()
+	v.MinLevel = 1000
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		now = now.Add(testUpdate)
+		v.Update(10, now)
+	}
+	// far above the floor, but below the minimum
+	now = now.Add(testUpdate)
+	if v.Update(900, now) {
+		t.Error("talking below MinLevel")
+	}
+	now = now.Add(testUpdate)
+	if !v.Update(1100, now) {
+		t.Error("not talking above MinLevel")
+	}
+}
+
+func TestMicStartsSilent(t *testing.T) {
+	src := &PCMSource{Samples: []uint16{silence + 1000, silence - 1000}, Rate: testRate}
+	m := New(src, testWindow)
+	if v := m.Value(); v != 0 {
+		t.Errorf("before any samples: level %v, want 0", v)
+	}
+	src.Advance(2)
+	// two samples into a window of silence
+	want := 1000 * math.Sqrt(2/float64(m.Size()))
+	if v := float64(m.Value()); math.Abs(v-want) > 0.01*want {
+		t.Errorf("after 2 samples: level %v, want %v", v, want)
+	}
+}
+
+func TestVADOpenness(t *testing.T) {
+	v := NewVAD()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	// feeds level for d, and returns the openness after each update
+	step := func(level float32, d time.Duration) []uint8 {
+		var o []uint8
+		for end := now.Add(d); now.Before(end); {
+			now = now.Add(testUpdate)
+			v.Update(level, now)
+			o = append(o, v.Openness())
+			if (o[len(o)-1] != 0) != v.Talking() {
+				t.Fatalf("openness %d while talking is %v", o[len(o)-1], v.Talking())
+			}
+		}
+		return o
+	}
+	last := func(o []uint8) uint8 { return o[len(o)-1] }
+
+	step(100, 5*time.Second)
+	if o := v.Openness(); o != 0 {
+		t.Fatalf("openness %d in silence", o)
+	}
+
+	// the close threshold is 160, so with the default range of 6, 960 and up is fully open
+	var prev uint8
+	for _, level := range []float32{260, 400, 600, 800} {
+		o := last(step(level, 200*time.Millisecond))
+		if o <= prev || o == 255 {
+			t.Errorf("level %v: openness %d, want more than %d and less than 255", level, o, prev)
+		}
+		prev = o
+	}
+	if o := last(step(2000, 200*time.Millisecond)); o != 255 {
+		t.Errorf("level 2000: openness %d, want 255", o)
+	}
+
+	// attack is quicker than release: count updates to get halfway up, and halfway back down
+	step(300, time.Second)
+	mid := uint8((int(v.Openness()) + 255) / 2)
+	up, down := 0, 0
+	for _, o := range step(2000, time.Second) {
+		if o >= mid {
+			break
+		}
+		up++
+	}
+	for _, o := range step(300, time.Second) {
+		if o <= mid {
+			break
+		}
+		down++
+	}
+	if up >= down {
+		t.Errorf("opened halfway in %d updates, but closed halfway in %d", up, down)
+	}
+
+	if o := last(step(100, time.Second)); o != 0 {
+		t.Errorf("openness %d after talking stopped", o)
+	}
+}
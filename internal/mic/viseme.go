@@ -0,0 +1,206 @@
+package mic
+
+import "math"
+
+// Viseme is a rough mouth shape for a sound.
+type Viseme uint8
+
+const (
+	VisemeClosed Viseme = iota
+	// as in "father"
+	VisemeA
+	// as in "bed" and "see"
+	VisemeE
+	// as in "go" and "food"
+	VisemeO
+	// hissing sounds, like "s", "sh" and "f"
+	VisemeSS
+)
+
+func (v Viseme) String() string {
+	switch v {
+	case VisemeClosed:
+		return "closed"
+	case VisemeA:
+		return "A"
+	case VisemeE:
+		return "E"
+	case VisemeO:
+		return "O"
+	case VisemeSS:
+		return "SS"
+	}
+	return "unknown"
+}
+
+// typical first and second formants of each vowel, in Hz
+var formants = [...]struct {
+	v      Viseme
+	f1, f2 float64
+}{
+	{VisemeA, 750, 1250},
+	{VisemeE, 450, 2000},
+	{VisemeO, 480, 900},
+}
+
+// frequencies the classifier listens at: closely spaced through the formant range, then coarser above it for hissing
+const (
+	formantLow  = 200
+	formantHigh = 3000
+	formantStep = 150
+	// the first and second formants are always at least this far apart
+	formantGap = 250
+	// the first formant is the lowest peak with at least this fraction of the strongest peak's power
+	firstFormantPeak = 0.25
+	hissLow          = 3500
+	hissStep         = 500
+	hissHigh         = 7000
+)
+
+// Classifier guesses the viseme for a short window of speech from its spectrum: hissing has most of its energy up high,
+// and vowels are told apart by their first two formants. It is deliberately simple, and only tells roughly what shape
+// the mouth should be; it is not speech recognition.
+type Classifier struct {
+	// MinLevel is the level, in the same units as Mic.Value, below which the window counts as silence.
+	MinLevel float32
+	// Hiss is the fraction of the energy that must be above hissLow for hissing.
+	Hiss float32
+
+	bank   []goertzel
+	window []float32
+	x      []float32
+	power  []float32
+}
+
+// NewClassifier returns a Classifier for samples taken at rate Hz.
+func NewClassifier(rate float32) *Classifier {
+	c := &Classifier{
+		MinLevel: 200,
+		Hiss:     0.5,
+	}
+	nyquist := rate / 2
+	for f := float32(formantLow); f <= formantHigh && f < nyquist; f += formantStep {
+		c.bank = append(c.bank, newGoertzel(f, rate))
+	}
+	for f := float32(hissLow); f <= hissHigh && f < nyquist; f += hissStep {
+		c.bank = append(c.bank, newGoertzel(f, rate))
+	}
+	c.power = make([]float32, len(c.bank))
+	return c
+}
+
+// Classify returns the viseme for samples, which should be at least 10 ms long to resolve formants, and how confident
+// it is, from 0 to 1.
+func (c *Classifier) Classify(samples []uint16) (Viseme, float32) {
+	if len(samples) == 0 {
+		return VisemeClosed, 1
+	}
+	c.prepare(samples)
+
+	var sumSq float32
+	for _, v := range c.x {
+		sumSq += v * v
+	}
+	// the window reduces the level, but not by enough to matter here
+	if float32(math.Sqrt(float64(sumSq/float32(len(c.x))))) < c.MinLevel {
+		return VisemeClosed, 1
+	}
+
+	var total, hiss float32
+	for i, g := range c.bank {
+		c.power[i] = g.power(c.x)
+		total += c.power[i]
+		if g.freq >= hissLow {
+			hiss += c.power[i]
+		}
+	}
+	if total == 0 {
+		return VisemeClosed, 1
+	}
+	if h := hiss / total; h >= c.Hiss {
+		return VisemeSS, (h - c.Hiss) / (1 - c.Hiss)
+	}
+
+	f1, f2 := c.formants()
+	if f1 == 0 || f2 == 0 {
+		return VisemeClosed, 0
+	}
+
+	// compare on a log scale, since formants vary proportionally between speakers
+	best, second := math.Inf(1), math.Inf(1)
+	v := VisemeClosed
+	for _, f := range formants {
+		d1 := math.Log(float64(f1) / f.f1)
+		d2 := math.Log(float64(f2) / f.f2)
+		d := d1*d1 + d2*d2
+		if d < best {
+			best, second, v = d, best, f.v
+		} else if d < second {
+			second = d
+		}
+	}
+	return v, float32(1 - best/second)
+}
+
+// prepare removes the DC offset from samples and applies a Hann window, to stop strong frequencies leaking into the
+// neighbouring bins.
+func (c *Classifier) prepare(samples []uint16) {
+	if len(c.window) != len(samples) {
+		c.window = make([]float32, len(samples))
+		c.x = make([]float32, len(samples))
+		for i := range c.window {
+			c.window[i] = float32(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(samples))))
+		}
+	}
+
+	var sum uint32
+	for _, v := range samples {
+		sum += uint32(v)
+	}
+	mean := float32(sum) / float32(len(samples))
+	for i, v := range samples {
+		c.x[i] = (float32(v) - mean) * c.window[i]
+	}
+}
+
+// formants finds the first two formants as peaks in the spectrum: the first is the lowest strong peak, and the second
+// is the strongest peak far enough above it. Either is 0 if there isn't one.
+func (c *Classifier) formants() (f1, f2 float32) {
+	// the formant bins come first
+	n := 0
+	var max float32
+	for n < len(c.bank) && c.bank[n].freq <= formantHigh {
+		if c.power[n] > max {
+			max = c.power[n]
+		}
+		n++
+	}
+
+	var f2Power float32
+	for i := 1; i < n-1; i++ {
+		p := c.power[i]
+		if p < c.power[i-1] || p <= c.power[i+1] {
+			continue
+		}
+		switch f := c.peak(i); {
+		case f1 == 0:
+			if p >= max*firstFormantPeak {
+				f1 = f
+			}
+		case f >= f1+formantGap && p > f2Power:
+			f2, f2Power = f, p
+		}
+	}
+	return f1, f2
+}
+
+// peak estimates the frequency of the peak at bin i, which is usually between bins, by fitting a parabola to it and its
+// neighbours.
+func (c *Classifier) peak(i int) float32 {
+	l, m, r := c.power[i-1], c.power[i], c.power[i+1]
+	d := l - 2*m + r
+	if d == 0 {
+		return c.bank[i].freq
+	}
+	return c.bank[i].freq + formantStep*0.5*(l-r)/d
+}
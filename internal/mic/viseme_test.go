@@ -0,0 +1,129 @@
+package mic
+
+import (
+	"math"
+	"testing"
+)
+
+// samples long enough to resolve formants, as on the badge
+const testClassifyLen = int(testRate * 16 / 1000)
+
+func TestGoertzel(t *testing.T) {
+	const n = 500
+	// whole numbers of cycles in n samples, so there's no leakage between them
+	const freq, other = testRate * 20 / n, testRate * 45 / n
+
+	x := make([]float32, n)
+	for i := range x {
+		x[i] = 1000*float32(math.Sin(2*math.Pi*freq*float64(i)/testRate)) +
+			300*float32(math.Cos(2*math.Pi*other*float64(i)/testRate)) + 50
+	}
+
+	tests := []struct {
+		freq float32
+		want float32
+	}{
+		// a sinusoid of amplitude A has power A²/4
+		{freq, 1000 * 1000 / 4},
+		{other, 300 * 300 / 4},
+		{testRate * 33 / n, 0},
+	}
+	for _, tt := range tests {
+		got := newGoertzel(tt.freq, testRate).power(x)
+		if math.Abs(float64(got-tt.want)) > 0.01*float64(tt.want)+1 {
+			t.Errorf("power at %v Hz = %v, want %v", tt.freq, got, tt.want)
+		}
+	}
+}
+
+// vowel synthesizes a voiced sound: harmonics of a 140 Hz voice falling off at 6 dB per octave, as speech does, shaped
+// by resonances at the first two formants.
+func vowel(f1, f2, amplitude float64) []uint16 {
+	const f0 = 140
+	res := func(f, fc, bw float64) float64 {
+		d := (f - fc) / bw
+		return 1 / (1 + d*d)
+	}
+	x := make([]float64, testClassifyLen)
+	for h := f0; h < 4000; h += f0 {
+		a := (res(float64(h), f1, 80) + res(float64(h), f2, 120)) * f0 / float64(h)
+		for i := range x {
+			x[i] += a * math.Sin(2*math.Pi*float64(h)*float64(i)/testRate+float64(h))
+		}
+	}
+	return scale(x, amplitude)
+}
+
+// hiss synthesizes a fricative: noise with the low frequencies taken out.
+func hiss(amplitude float64) []uint16 {
+	n := noise(1)
+	x := make([]float64, testClassifyLen)
+	var p1, p2 float64
+	for i := range x {
+		v := n()
+		// twice differentiated, which rises 12 dB per octave
+		x[i] = v - 2*p1 + p2
+		p2, p1 = p1, v
+	}
+	return scale(x, amplitude)
+}
+
+// scale makes x into samples with a standard deviation of amplitude.
+func scale(x []float64, amplitude float64) []uint16 {
+	var sumSq float64
+	for _, v := range x {
+		sumSq += v * v
+	}
+	k := amplitude / math.Sqrt(sumSq/float64(len(x)))
+	s := make([]uint16, len(x))
+	for i, v := range x {
+		s[i] = uint16(silence + k*v)
+	}
+	return s
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []uint16
+		want    Viseme
+	}{
+		{"empty", nil, VisemeClosed},
+		{"silence", scale(make([]float64, testClassifyLen), 0), VisemeClosed},
+		{"too quiet", vowel(750, 1250, 100), VisemeClosed},
+		{"father", vowel(750, 1250, 3000), VisemeA},
+		{"bed", vowel(530, 1850, 3000), VisemeE},
+		{"see", vowel(300, 2250, 3000), VisemeE},
+		{"go", vowel(500, 900, 3000), VisemeO},
+		{"food", vowel(330, 870, 3000), VisemeO},
+		{"hiss", hiss(3000), VisemeSS},
+	}
+	c := NewClassifier(testRate)
+	for _, tt := range tests {
+		if got, conf := c.Classify(tt.samples); got != tt.want {
+			t.Errorf("%s: got %v (%.2f), want %v", tt.name, got, conf, tt.want)
+		} else if conf < 0 || conf > 1 {
+			t.Errorf("%s: confidence %v", tt.name, conf)
+		}
+	}
+}
+
+func TestClassifyScale(t *testing.T) {
+	// how loud doesn't change the shape
+	c := NewClassifier(testRate)
+	for _, amplitude := range []float64{500, 2000, 8000} {
+		if got, _ := c.Classify(vowel(750, 1250, amplitude)); got != VisemeA {
+			t.Errorf("amplitude %v: got %v, want %v", amplitude, got, VisemeA)
+		}
+	}
+}
+
+func TestVisemeString(t *testing.T) {
+	for v, want := range map[Viseme]string{
+		VisemeClosed: "closed", VisemeA: "A", VisemeE: "E", VisemeO: "O", VisemeSS: "SS", 99: "unknown",
+	} {
+		if got := v.String(); got != want {
+			t.Errorf("Viseme(%d).String() = %q, want %q", v, got, want)
+		}
+	}
+}
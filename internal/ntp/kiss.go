@@ -0,0 +1,106 @@
+package ntp
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Kiss-o'-Death handling, see RFC 4330 section 8.
+
+const (
+	minRateBackoff = time.Minute
+	maxRateBackoff = 4 * time.Hour
+)
+
+// BackoffError is returned instead of querying a server that has previously sent a Kiss-o'-Death.
+type BackoffError struct {
+	Code string
+	// Until is when the server may be queried again. It is zero if the server must not be queried again.
+	Until time.Time
+}
+
+func (e *BackoffError) Error() string {
+	if e.Until.IsZero() {
+		return "server sent " + e.Code
+	}
+	return e.Code + " backoff " + time.Until(e.Until).Round(time.Second).String()
+}
+
+type kissState struct {
+	code  string
+	until time.Time
+	wait  time.Duration
+	deny  bool
+}
+
+// kissed tracks servers that have sent a Kiss-o'-Death, by host:port. This lives until reboot. It's used by the boot
+// sync and the background resync, so it's guarded by kissLock.
+var (
+	kissLock sync.Mutex
+	kissed   = make(map[string]*kissState)
+)
+
+// CheckBackoff returns nil if at least one of servers may be queried now, or the first server's *BackoffError if none
+// may. It can be used to avoid bringing up the network for nothing.
+func CheckBackoff(servers []string) error {
+	var err error = ErrNoResponse
+	for _, host := range servers {
+		if err = checkBackoff(host); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkBackoff returns a *BackoffError if host should not be queried right now.
+func checkBackoff(host string) error {
+	kissLock.Lock()
+	defer kissLock.Unlock()
+
+	k, ok := kissed[host]
+	if !ok {
+		return nil
+	}
+	if k.deny {
+		return &BackoffError{Code: k.code}
+	}
+	if time.Now().Before(k.until) {
+		return &BackoffError{Code: k.code, Until: k.until}
+	}
+	return nil
+}
+
+// recordKiss updates the backoff state for host if err is a *KissError. Each RATE doubles the backoff for that server;
+// DENY and RSTR mean the server must never be queried again. Other kiss codes are treated as ordinary failures.
+func recordKiss(host string, err error) {
+	var ke *KissError
+	if !errors.As(err, &ke) {
+		return
+	}
+
+	kissLock.Lock()
+	defer kissLock.Unlock()
+	k, ok := kissed[host]
+	if !ok {
+		k = &kissState{}
+	}
+	k.code = ke.Code
+
+	switch ke.Code {
+	case "DENY", "RSTR":
+		k.deny = true
+	case "RATE":
+		k.wait *= 2
+		if k.wait < minRateBackoff {
+			k.wait = minRateBackoff
+		}
+		if k.wait > maxRateBackoff {
+			k.wait = maxRateBackoff
+		}
+		k.until = time.Now().Add(k.wait)
+	default:
+		return
+	}
+	kissed[host] = k
+}
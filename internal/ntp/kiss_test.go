@@ -0,0 +1,29 @@
+package ntp
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// The boot sync and the background resync can both record and check kisses; run with -race.
+func TestKissConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		host := "concurrent" + strconv.Itoa(i) + ".test:123"
+		defer func() {
+			kissLock.Lock()
+			delete(kissed, host)
+			kissLock.Unlock()
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				recordKiss(host, &KissError{Code: "RATE"})
+				_ = CheckBackoff([]string{host, "concurrent0.test:123"})
+			}
+		}()
+	}
+	wg.Wait()
+}
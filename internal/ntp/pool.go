@@ -0,0 +1,115 @@
+package ntp
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ajanata/textbuf"
+)
+
+// DialFunc connects to address on the named network, like net.Dial.
+type DialFunc func(network, address string) (net.Conn, error)
+
+// ErrNoResponse is returned when none of the servers produced a usable sample.
+var ErrNoResponse = errors.New("no server replied")
+
+const (
+	// how long to wait for each reply
+	sampleTimeout = 2 * time.Second
+	// spacing between samples to the same server, so we don't earn a RATE
+	sampleInterval = 250 * time.Millisecond
+)
+
+// Sync takes up to samples samples from each of servers (host:port) and returns the one with the lowest round-trip
+// delay, since that is the one least affected by asymmetric network latency. The network must already be up; dial is
+// used to reach each server, and is normally net.Dial. The local clock is not modified; the caller should apply the
+// returned Result's Offset (e.g. with runtime.AdjustTimeOffset) if it wants to use it.
+//
+// Replies that fail validation are rejected with one of the Err* values or a *KissError. A server that sent a
+// Kiss-o'-Death is not contacted again until its backoff expires. Each server's result is reported on buf, if not nil.
+// A failing server doesn't stop the others from being tried; if none produced a usable sample, ErrNoResponse is
+// returned.
+func Sync(dial DialFunc, servers []string, samples int, buf *textbuf.Buffer) (Result, error) {
+	if samples < 1 {
+		samples = 1
+	}
+
+	var best Result
+	found := false
+
+	for _, host := range servers {
+		res, n, err := queryServer(dial, host, samples)
+		if n == 0 {
+			println("ntp", host+":", err.Error())
+			if buf != nil {
+				_ = buf.PrintlnInverse(hostName(host) + ": " + err.Error())
+			}
+			continue
+		}
+		println("ntp", host+":", n, "samples, delay", res.Delay.String(), "offset", res.Offset.String())
+		if buf != nil {
+			_ = buf.Println(hostName(host) + ": " + strconv.Itoa(int(res.Delay/time.Millisecond)) + "ms")
+		}
+		if !found || res.Delay < best.Delay {
+			best = res
+			found = true
+		}
+	}
+
+	if !found {
+		return Result{}, ErrNoResponse
+	}
+	return best, nil
+}
+
+// queryServer returns the lowest-delay sample of up to samples exchanges with host, the number of good samples, and the
+// last error encountered.
+func queryServer(dial DialFunc, host string, samples int) (Result, int, error) {
+	if err := checkBackoff(host); err != nil {
+		return Result{}, 0, err
+	}
+
+	conn, err := dial("udp", host)
+	if err != nil {
+		return Result{}, 0, err
+	}
+	defer conn.Close()
+
+	var best Result
+	n := 0
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		if i > 0 {
+			time.Sleep(sampleInterval)
+		}
+		_ = conn.SetDeadline(time.Now().Add(sampleTimeout))
+		res, err := getCurrentTime(conn)
+		if err != nil {
+			lastErr = err
+			recordKiss(host, err)
+			var ke *KissError
+			if errors.As(err, &ke) {
+				// whatever the code, this server doesn't want to talk to us right now
+				break
+			}
+			continue
+		}
+		if n == 0 || res.Delay < best.Delay {
+			best = res
+		}
+		n++
+	}
+
+	return best, n, lastErr
+}
+
+// hostName strips the port from host, for display.
+func hostName(host string) string {
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	return h
+}
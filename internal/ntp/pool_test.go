@@ -0,0 +1,64 @@
+package ntp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSyncLowestDelay(t *testing.T) {
+	// the slow server's clock is off by more, so picking it would show in the offset
+	slow := fakeServer(t, func(req []byte) []byte {
+		time.Sleep(40 * time.Millisecond)
+		return serverReply(req, 5*time.Second)
+	})
+	fast := fakeServer(t, func(req []byte) []byte { return serverReply(req, time.Second) })
+
+	res, err := Sync(net.Dial, []string{slow, fast}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := res.Offset - time.Second; d < -30*time.Millisecond || d > 30*time.Millisecond {
+		t.Errorf("got offset %s, want the fast server's 1s", res.Offset)
+	}
+	if res.Delay >= 40*time.Millisecond {
+		t.Errorf("got delay %s, want the fast server's", res.Delay)
+	}
+}
+
+func TestSyncFallback(t *testing.T) {
+	// nothing listens on a closed port, so reads fail straight away
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := pc.LocalAddr().String()
+	_ = pc.Close()
+
+	unsynced := fakeServer(t, func(req []byte) []byte {
+		r := serverReply(req, 0)
+		r[0] |= leapUnsynchronized << 6
+		return r
+	})
+	good := fakeServer(t, func(req []byte) []byte { return serverReply(req, 2*time.Second) })
+
+	res, err := Sync(net.Dial, []string{dead, unsynced, good}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := res.Offset - 2*time.Second; d < -30*time.Millisecond || d > 30*time.Millisecond {
+		t.Errorf("got offset %s, want 2s", res.Offset)
+	}
+
+	_, err = Sync(net.Dial, []string{dead, unsynced}, 1, nil)
+	if !errors.Is(err, ErrNoResponse) {
+		t.Errorf("with no good servers, got %v", err)
+	}
+
+	dialErr := errors.New("no route")
+	_, err = Sync(func(network, address string) (net.Conn, error) { return nil, dialErr }, []string{good}, 1, nil)
+	if !errors.Is(err, ErrNoResponse) {
+		t.Errorf("when dial fails, got %v", err)
+	}
+}
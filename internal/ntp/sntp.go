@@ -0,0 +1,202 @@
+// Package ntp is a small SNTP (RFC 4330) client. It only talks to the servers; bringing the network up is up to the
+// caller.
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const ntpPacketSize = 48
+
+// seconds between the NTP epoch (1900-01-01) and the Unix epoch (1970-01-01)
+const ntpEpochOffset = 2208988800
+
+// LI = 3 (unsynchronized), VN = 4, Mode = 3 (client)
+const requestHeader = leapUnsynchronized<<6 | ntpVersion<<3 | modeClient
+
+const (
+	leapUnsynchronized = 3
+	ntpVersion         = 4
+	modeClient         = 3
+	modeServer         = 4
+	maxStratum         = 15
+)
+
+// packet field offsets, see RFC 4330 section 4
+const (
+	offStratum   = 1
+	offRefID     = 12
+	offOriginate = 24
+	offReceive   = 32
+	offTransmit  = 40
+)
+
+// Errors returned for responses that fail validation. These are short enough to show on the menu display.
+var (
+	ErrMalformed      = errors.New("malformed reply")
+	ErrVersion        = errors.New("bad NTP version")
+	ErrMode           = errors.New("not a server reply")
+	ErrUnsynchronized = errors.New("server unsynced")
+	ErrStratum        = errors.New("bad stratum")
+	ErrOriginate      = errors.New("reply not for us")
+	ErrNoTimestamp    = errors.New("no timestamp")
+)
+
+// KissError is returned when the server replies with a Kiss-o'-Death packet (stratum 0). Code is the four-character
+// kiss code, e.g. "RATE" or "DENY".
+type KissError struct {
+	Code string
+}
+
+func (e *KissError) Error() string {
+	return "kiss-o'-death: " + e.Code
+}
+
+// Result is the outcome of a single SNTP exchange.
+type Result struct {
+	// Time is the corrected time at the moment the response was received.
+	Time time.Time
+	// Offset is how far the local clock is behind the server's clock. Adding it to the local clock corrects it,
+	// e.g. with runtime.AdjustTimeOffset.
+	Offset time.Duration
+	// Delay is the round-trip network delay, not counting the time the server spent processing the request.
+	Delay time.Duration
+	// Stratum is the stratum reported by the server.
+	Stratum uint8
+}
+
+// ntpTime is a 64-bit NTP timestamp: 32 bits of seconds and 32 bits of fraction. The seconds wrap every 2^32 seconds
+// (an "era"); the first wrap is at 2036-02-07 06:28:16 UTC.
+type ntpTime uint64
+
+// eraBit is the most significant bit of the seconds field. Following RFC 4330 section 3, a timestamp with it set is in
+// era 0 (1968-2036), and one with it clear is in era 1 (2036-2104).
+const eraBit = 1 << 31
+
+// toNTPTime converts t to an NTP timestamp. Only the low 32 bits of the seconds are kept, so times from 1968 through 2104
+// round-trip through ntpTime.Time.
+func toNTPTime(t time.Time) ntpTime {
+	sec := uint64(t.Unix()+ntpEpochOffset) & 0xFFFFFFFF
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return ntpTime(sec<<32 | frac)
+}
+
+// Time converts t to a time.Time, choosing its era per RFC 4330.
+func (t ntpTime) Time() time.Time {
+	sec := int64(t >> 32)
+	if sec&eraBit == 0 {
+		sec += 1 << 32
+	}
+	// round to nearest so that nanoseconds survive a round trip through toNTPTime
+	nsec := (uint64(t&0xFFFFFFFF)*1e9 + 1<<31) >> 32
+	return time.Unix(sec-ntpEpochOffset, int64(nsec))
+}
+
+// Query performs a single SNTP exchange over conn, which must already be connected to the server. The local clock is
+// not modified.
+func Query(conn net.Conn) (Result, error) {
+	return getCurrentTime(conn)
+}
+
+func getCurrentTime(conn net.Conn) (Result, error) {
+	t1 := time.Now()
+	if err := sendNTPpacket(conn, t1); err != nil {
+		return Result{}, err
+	}
+
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	t4 := time.Now()
+	if err != nil && err != io.EOF {
+		return Result{}, err
+	}
+	if n != ntpPacketSize {
+		return Result{}, fmt.Errorf("%w: %d bytes", ErrMalformed, n)
+	}
+	if err := validateNTPPacket(response, toNTPTime(t1)); err != nil {
+		return Result{}, err
+	}
+
+	return parseNTPPacket(response, t1, t4), nil
+}
+
+// validateNTPPacket checks the response r against the client rules in RFC 4330 section 5. sent is the transmit
+// timestamp of the request, which the server must echo back as the originate timestamp. That is checked first, so that
+// a spoofed reply from off the path, which can't know it, is never acted on, e.g. as a Kiss-o'-Death.
+func validateNTPPacket(r []byte, sent ntpTime) error {
+	li := r[0] >> 6
+	vn := r[0] >> 3 & 0x7
+	mode := r[0] & 0x7
+	stratum := r[offStratum]
+
+	if ntpTime(binary.BigEndian.Uint64(r[offOriginate:])) != sent {
+		return ErrOriginate
+	}
+	if vn < 3 || vn > ntpVersion {
+		return ErrVersion
+	}
+	if mode != modeServer {
+		return ErrMode
+	}
+	if stratum == 0 {
+		return &KissError{Code: kissCode(r[offRefID : offRefID+4])}
+	}
+	if li == leapUnsynchronized {
+		return ErrUnsynchronized
+	}
+	if stratum > maxStratum {
+		return ErrStratum
+	}
+	if binary.BigEndian.Uint64(r[offTransmit:]) == 0 {
+		return ErrNoTimestamp
+	}
+	return nil
+}
+
+// kissCode returns the printable part of the kiss code in the reference ID field.
+func kissCode(b []byte) string {
+	n := 0
+	for n < len(b) && b[n] >= 0x20 && b[n] < 0x7F {
+		n++
+	}
+	return string(b[:n])
+}
+
+func sendNTPpacket(conn net.Conn, now time.Time) error {
+	var request [ntpPacketSize]byte
+	request[0] = requestHeader
+	// the server copies this into the originate timestamp of its response
+	binary.BigEndian.PutUint64(request[offTransmit:], uint64(toNTPTime(now)))
+
+	_, err := conn.Write(request[:])
+	return err
+}
+
+// parseNTPPacket computes the clock offset and round-trip delay from the response r, given the local times the
+// request was sent (t1) and the response was received (t4).
+func parseNTPPacket(r []byte, t1, t4 time.Time) Result {
+	t2 := ntpTime(binary.BigEndian.Uint64(r[offReceive:])).Time()
+	t3 := ntpTime(binary.BigEndian.Uint64(r[offTransmit:])).Time()
+
+	// RFC 4330 section 5:
+	//   delay  = (T4 - T1) - (T3 - T2)
+	//   offset = ((T2 - T1) + (T3 - T4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+	if delay < 0 {
+		// server and local clock resolution can make this slightly negative
+		delay = 0
+	}
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+
+	return Result{
+		Time:    t4.Add(offset),
+		Offset:  offset,
+		Delay:   delay,
+		Stratum: r[offStratum],
+	}
+}
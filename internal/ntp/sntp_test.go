@@ -0,0 +1,220 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer answers SNTP requests on a loopback UDP port with whatever reply returns for each request. It is closed
+// when the test ends.
+func fakeServer(t *testing.T, reply func(req []byte) []byte) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if r := reply(buf[:n]); r != nil {
+				_, _ = pc.WriteTo(r, addr)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// serverReply returns a valid stratum 2 reply to req from a server whose clock is offset ahead of ours.
+func serverReply(req []byte, offset time.Duration) []byte {
+	r := make([]byte, ntpPacketSize)
+	r[0] = 0<<6 | ntpVersion<<3 | modeServer
+	r[offStratum] = 2
+	copy(r[offRefID:], "GPS\x00")
+	copy(r[offOriginate:offOriginate+8], req[offTransmit:offTransmit+8])
+	now := time.Now().Add(offset)
+	binary.BigEndian.PutUint64(r[offReceive:], uint64(toNTPTime(now)))
+	binary.BigEndian.PutUint64(r[offTransmit:], uint64(toNTPTime(now)))
+	return r
+}
+
+func dialFake(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	return conn
+}
+
+func TestQueryOffset(t *testing.T) {
+	// loopback round trips are well under this, even on a busy machine
+	const tolerance = 50 * time.Millisecond
+
+	for _, offset := range []time.Duration{0, 3 * time.Second, -2500 * time.Millisecond, 90 * 24 * time.Hour} {
+		offset := offset
+		t.Run(offset.String(), func(t *testing.T) {
+			addr := fakeServer(t, func(req []byte) []byte { return serverReply(req, offset) })
+			res, err := Query(dialFake(t, addr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := res.Offset - offset; d < -tolerance || d > tolerance {
+				t.Errorf("got offset %s", res.Offset)
+			}
+			if res.Delay < 0 || res.Delay > tolerance {
+				t.Errorf("got delay %s", res.Delay)
+			}
+			if d := time.Until(res.Time) - offset; d < -tolerance || d > tolerance {
+				t.Errorf("got time %s", res.Time)
+			}
+			if res.Stratum != 2 {
+				t.Errorf("got stratum %d", res.Stratum)
+			}
+		})
+	}
+}
+
+func TestParseNTPPacket(t *testing.T) {
+	t1 := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		t2, t3, t4    time.Duration // after t1
+		offset, delay time.Duration
+	}{
+		{"in sync", 10 * time.Millisecond, 11 * time.Millisecond, 21 * time.Millisecond, 0, 20 * time.Millisecond},
+		{"behind", 1010 * time.Millisecond, 1015 * time.Millisecond, 30 * time.Millisecond, 997500 * time.Microsecond, 25 * time.Millisecond},
+		{"ahead", -1990 * time.Millisecond, -1980 * time.Millisecond, 30 * time.Millisecond, -2 * time.Second, 20 * time.Millisecond},
+		{"asymmetric", 40 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 15 * time.Millisecond, 50 * time.Millisecond},
+		// the server's clock is coarser than ours, making the delay slightly negative
+		{"negative delay", 5 * time.Millisecond, 12 * time.Millisecond, 6 * time.Millisecond, 5500 * time.Microsecond, 0},
+	}
+	for _, tt := range tests {
+		r := make([]byte, ntpPacketSize)
+		r[offStratum] = 1
+		binary.BigEndian.PutUint64(r[offReceive:], uint64(toNTPTime(t1.Add(tt.t2))))
+		binary.BigEndian.PutUint64(r[offTransmit:], uint64(toNTPTime(t1.Add(tt.t3))))
+		t4 := t1.Add(tt.t4)
+
+		res := parseNTPPacket(r, t1, t4)
+		// timestamps are only exact to a nanosecond or so after conversion
+		if d := res.Offset - tt.offset; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("%s: got offset %s, want %s", tt.name, res.Offset, tt.offset)
+		}
+		if d := res.Delay - tt.delay; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("%s: got delay %s, want %s", tt.name, res.Delay, tt.delay)
+		}
+		if !res.Time.Equal(t4.Add(res.Offset)) {
+			t.Errorf("%s: got time %s, want %s", tt.name, res.Time, t4.Add(res.Offset))
+		}
+		if res.Stratum != 1 {
+			t.Errorf("%s: got stratum %d", tt.name, res.Stratum)
+		}
+	}
+}
+
+func TestQueryRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(r []byte) []byte
+		want  error
+		kiss  string
+	}{
+		{"short", func(r []byte) []byte { return r[:40] }, ErrMalformed, ""},
+		{"version 2", func(r []byte) []byte { r[0] = r[0]&^0x38 | 2<<3; return r }, ErrVersion, ""},
+		{"version 5", func(r []byte) []byte { r[0] = r[0]&^0x38 | 5<<3; return r }, ErrVersion, ""},
+		{"client mode", func(r []byte) []byte { r[0] = r[0]&^0x7 | modeClient; return r }, ErrMode, ""},
+		{"broadcast mode", func(r []byte) []byte { r[0] = r[0]&^0x7 | 5; return r }, ErrMode, ""},
+		{"unsynchronized", func(r []byte) []byte { r[0] |= leapUnsynchronized << 6; return r }, ErrUnsynchronized, ""},
+		{"stratum 16", func(r []byte) []byte { r[offStratum] = 16; return r }, ErrStratum, ""},
+		{"no timestamp", func(r []byte) []byte { copy(r[offTransmit:], make([]byte, 8)); return r }, ErrNoTimestamp, ""},
+		{"wrong originate", func(r []byte) []byte { r[offOriginate+7] ^= 1; return r }, ErrOriginate, ""},
+		{"kiss RATE", kiss("RATE"), nil, "RATE"},
+		{"kiss DENY", kiss("DENY"), nil, "DENY"},
+		{"kiss unprintable", kiss("AB\x00\x01"), nil, "AB"},
+		// an off-path attacker can't know the originate timestamp, so its kiss must not count
+		{"spoofed kiss", func(r []byte) []byte { r = kiss("DENY")(r); r[offOriginate+7] ^= 1; return r }, ErrOriginate, ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeServer(t, func(req []byte) []byte { return tt.reply(serverReply(req, 0)) })
+			_, err := Query(dialFake(t, addr))
+
+			var ke *KissError
+			switch {
+			case tt.kiss != "":
+				if !errors.As(err, &ke) || ke.Code != tt.kiss {
+					t.Errorf("got %v, want kiss %q", err, tt.kiss)
+				}
+			case !errors.Is(err, tt.want):
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// kiss turns a reply into a Kiss-o'-Death with code.
+func kiss(code string) func(r []byte) []byte {
+	return func(r []byte) []byte {
+		r[0] = leapUnsynchronized<<6 | ntpVersion<<3 | modeServer
+		r[offStratum] = 0
+		copy(r[offRefID:offRefID+4], code)
+		return r
+	}
+}
+
+func TestKissBackoff(t *testing.T) {
+	const host = "kiss.test:123"
+	defer delete(kissed, host)
+
+	if err := checkBackoff(host); err != nil {
+		t.Fatalf("before any kiss: %v", err)
+	}
+
+	// each RATE doubles the backoff, up to the maximum
+	want := minRateBackoff
+	for i := 0; i < 10; i++ {
+		recordKiss(host, &KissError{Code: "RATE"})
+		var be *BackoffError
+		if err := checkBackoff(host); !errors.As(err, &be) || be.Code != "RATE" {
+			t.Fatalf("RATE %d: got %v", i, err)
+		}
+		if got := time.Until(be.Until); got > want || got < want-time.Second {
+			t.Errorf("RATE %d: backoff %s, want %s", i, got, want)
+		}
+		if want *= 2; want > maxRateBackoff {
+			want = maxRateBackoff
+		}
+	}
+
+	// other codes and errors don't change anything
+	until := kissed[host].until
+	recordKiss(host, &KissError{Code: "INIT"})
+	recordKiss(host, ErrOriginate)
+	if k := kissed[host]; k.deny || !k.until.Equal(until) {
+		t.Errorf("non-RATE changed backoff: %+v", k)
+	}
+
+	recordKiss(host, &KissError{Code: "DENY"})
+	var be *BackoffError
+	if err := checkBackoff(host); !errors.As(err, &be) || be.Code != "DENY" || !be.Until.IsZero() {
+		t.Errorf("DENY: got %v", err)
+	}
+	if err := CheckBackoff([]string{host, "other.test:123"}); err != nil {
+		t.Errorf("CheckBackoff with another server: %v", err)
+	}
+	if err := CheckBackoff([]string{host}); !errors.As(err, &be) {
+		t.Errorf("CheckBackoff with only denied server: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestNTPTimeEras(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		ntp  ntpTime
+	}{
+		{"start of era 0 window", time.Date(1968, 1, 20, 3, 14, 8, 0, time.UTC), 0x80000000 << 32},
+		{"unix epoch", time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 2208988800 << 32},
+		{"half second", time.Date(1970, 1, 1, 0, 0, 0, 500_000_000, time.UTC), 2208988800<<32 | 0x80000000},
+		{"2024", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 3926188800 << 32},
+		{"last second of era 0", time.Date(2036, 2, 7, 6, 28, 15, 0, time.UTC), 0xFFFFFFFF << 32},
+		{"last fraction of era 0", time.Date(2036, 2, 7, 6, 28, 15, 999_999_999, time.UTC), 0xFFFFFFFF<<32 | 0xFFFFFFFB},
+		{"era 1 rollover", time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC), 0},
+		{"just after rollover", time.Date(2036, 2, 7, 6, 28, 16, 250_000_000, time.UTC), 0x40000000},
+		{"a day after rollover", time.Date(2036, 2, 8, 6, 28, 16, 0, time.UTC), 86400 << 32},
+		{"end of era 1 window", time.Date(2104, 2, 26, 9, 42, 23, 0, time.UTC), 0x7FFFFFFF << 32},
+	}
+	for _, tt := range tests {
+		if got := toNTPTime(tt.t); got != tt.ntp {
+			t.Errorf("%s: toNTPTime(%s) = %#016x, want %#016x", tt.name, tt.t, uint64(got), uint64(tt.ntp))
+		}
+		if got := tt.ntp.Time(); !got.Equal(tt.t) {
+			t.Errorf("%s: %#016x.Time() = %s, want %s", tt.name, uint64(tt.ntp), got.UTC(), tt.t)
+		}
+	}
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	start := time.Date(1968, 1, 20, 3, 14, 8, 0, time.UTC)
+	end := time.Date(2104, 2, 26, 9, 42, 23, 0, time.UTC)
+	step := end.Sub(start) / 997
+	for tm := start; tm.Before(end); tm = tm.Add(step) {
+		for _, ns := range []int{0, 1, 123_456_789, 999_999_999} {
+			in := time.Unix(tm.Unix(), int64(ns))
+			if got := toNTPTime(in).Time(); !got.Equal(in) {
+				t.Fatalf("%s came back as %s", in.UTC(), got.UTC())
+			}
+		}
+	}
+}
+
+// Offsets computed across the rollover must not jump by an era.
+func TestNTPTimeAcrossRollover(t *testing.T) {
+	rollover := time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC)
+	t1 := rollover.Add(-10 * time.Millisecond)
+	t2 := rollover.Add(-2 * time.Millisecond)
+	t3 := rollover.Add(3 * time.Millisecond)
+	t4 := rollover.Add(11 * time.Millisecond)
+
+	r := make([]byte, ntpPacketSize)
+	binary.BigEndian.PutUint64(r[offReceive:], uint64(toNTPTime(t2)))
+	binary.BigEndian.PutUint64(r[offTransmit:], uint64(toNTPTime(t3)))
+	res := parseNTPPacket(r, t1, t4)
+	if d := res.Offset; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("got offset %s across rollover", d)
+	}
+	if d := res.Delay - 16*time.Millisecond; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("got delay %s across rollover", res.Delay)
+	}
+}
@@ -0,0 +1,161 @@
+// Package settings persists user settings on the flash filesystem.
+//
+// The on-flash format is a small header (magic, format version, payload length), a payload of tag-length-value
+// records, and a CRC-32 of everything before it. Unknown tags are skipped and missing ones keep their defaults, so
+// settings can be added without bumping the version; the version only changes if the layout itself does.
+package settings
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// Settings is everything that survives a reboot.
+type Settings struct {
+	// Brightness is the menu's brightness step, 0-10.
+	Brightness   uint8
+	TalkCutoff   uint16
+	MicEnabled   bool
+	TouchEnabled bool
+	// TimeZone is a POSIX TZ string picked in the menu. Empty means the compiled-in default, or config.txt's.
+	TimeZone string
+	// RTCOffset is the PCF8523 offset register value measured by drift correction.
+	RTCOffset int8
+	// VADOpen and VADClose are the mic calibration's talking thresholds, in tenths of the noise floor. 0 means the
+	// default.
+	VADOpen  uint8
+	VADClose uint8
+}
+
+// Defaults returns the settings used when there are none saved.
+func Defaults() Settings {
+	return Settings{
+		Brightness: 4,
+		TalkCutoff: 3000,
+	}
+}
+
+var (
+	ErrCorrupt = errors.New("settings corrupt")
+	ErrVersion = errors.New("settings too new")
+)
+
+const (
+	magic         = "GTS"
+	formatVersion = 1
+	headerSize    = len(magic) + 1 + 2
+	crcSize       = 4
+)
+
+// record tags; never reuse a number
+const (
+	tagBrightness = iota + 1
+	tagTalkCutoff
+	tagMicEnabled
+	tagTouchEnabled
+	tagTimeZone
+	// reserved, never written
+	tagNTPServer
+	tagRTCOffset
+	tagVADOpen
+	tagVADClose
+)
+
+// Encode serializes s.
+func Encode(s Settings) []byte {
+	b := make([]byte, headerSize, 64)
+	copy(b, magic)
+	b[len(magic)] = formatVersion
+
+	b = appendRecord(b, tagBrightness, []byte{s.Brightness})
+	b = appendRecord(b, tagTalkCutoff, binary.BigEndian.AppendUint16(nil, s.TalkCutoff))
+	b = appendRecord(b, tagMicEnabled, []byte{boolByte(s.MicEnabled)})
+	b = appendRecord(b, tagTouchEnabled, []byte{boolByte(s.TouchEnabled)})
+	if s.TimeZone != "" {
+		b = appendRecord(b, tagTimeZone, []byte(s.TimeZone))
+	}
+	b = appendRecord(b, tagRTCOffset, []byte{byte(s.RTCOffset)})
+	b = appendRecord(b, tagVADOpen, []byte{s.VADOpen})
+	b = appendRecord(b, tagVADClose, []byte{s.VADClose})
+
+	binary.BigEndian.PutUint16(b[len(magic)+1:], uint16(len(b)-headerSize))
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+// Decode parses data produced by Encode. On error, it returns Defaults.
+func Decode(data []byte) (Settings, error) {
+	s := Defaults()
+	if len(data) < headerSize+crcSize || string(data[:len(magic)]) != magic {
+		return s, ErrCorrupt
+	}
+	if data[len(magic)] > formatVersion {
+		return s, ErrVersion
+	}
+	n := int(binary.BigEndian.Uint16(data[len(magic)+1:]))
+	if len(data) != headerSize+n+crcSize {
+		return s, ErrCorrupt
+	}
+	if crc32.ChecksumIEEE(data[:headerSize+n]) != binary.BigEndian.Uint32(data[headerSize+n:]) {
+		return s, ErrCorrupt
+	}
+
+	p := data[headerSize : headerSize+n]
+	for len(p) > 0 {
+		if len(p) < 2 || len(p) < 2+int(p[1]) {
+			return Defaults(), ErrCorrupt
+		}
+		tag, v := p[0], p[2:2+int(p[1])]
+		p = p[2+len(v):]
+
+		switch tag {
+		case tagBrightness:
+			if len(v) == 1 {
+				s.Brightness = v[0]
+			}
+		case tagTalkCutoff:
+			if len(v) == 2 {
+				s.TalkCutoff = binary.BigEndian.Uint16(v)
+			}
+		case tagMicEnabled:
+			if len(v) == 1 {
+				s.MicEnabled = v[0] != 0
+			}
+		case tagTouchEnabled:
+			if len(v) == 1 {
+				s.TouchEnabled = v[0] != 0
+			}
+		case tagTimeZone:
+			s.TimeZone = string(v)
+		case tagRTCOffset:
+			if len(v) == 1 {
+				s.RTCOffset = int8(v[0])
+			}
+		case tagVADOpen:
+			if len(v) == 1 {
+				s.VADOpen = v[0]
+			}
+		case tagVADClose:
+			if len(v) == 1 {
+				s.VADClose = v[0]
+			}
+		}
+	}
+	return s, nil
+}
+
+// appendRecord appends a record to b. Values longer than 255 bytes are truncated.
+func appendRecord(b []byte, tag byte, v []byte) []byte {
+	if len(v) > 0xFF {
+		v = v[:0xFF]
+	}
+	b = append(b, tag, byte(len(v)))
+	return append(b, v...)
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
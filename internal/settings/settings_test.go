@@ -0,0 +1,117 @@
+package settings
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []Settings{
+		Defaults(),
+		{},
+		{
+			Brightness:   10,
+			TalkCutoff:   4500,
+			MicEnabled:   true,
+			TouchEnabled: true,
+			TimeZone:     "NZST-12NZDT,M9.5.0,M4.1.0/3",
+			RTCOffset:    -64,
+			VADOpen:      35,
+			VADClose:     18,
+		},
+	}
+	for _, want := range tests {
+		got, err := Decode(Encode(want))
+		if err != nil {
+			t.Errorf("Decode(Encode(%+v)): %v", want, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Decode(Encode(%+v)) = %+v", want, got)
+		}
+	}
+}
+
+// build makes a settings file with a valid header and CRC around payload.
+func build(version byte, payload []byte) []byte {
+	b := append([]byte(magic), version, 0, 0)
+	binary.BigEndian.PutUint16(b[len(magic)+1:], uint16(len(payload)))
+	b = append(b, payload...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	good := Encode(Settings{Brightness: 7, TalkCutoff: 2500, MicEnabled: true})
+
+	flipped := append([]byte(nil), good...)
+	flipped[headerSize+2] ^= 0x01
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrCorrupt},
+		{"short", good[:headerSize+crcSize-1], ErrCorrupt},
+		{"magic", append([]byte("XTS"), good[len(magic):]...), ErrCorrupt},
+		{"truncated", good[:len(good)-1], ErrCorrupt},
+		{"trailing", append(append([]byte(nil), good...), 0), ErrCorrupt},
+		{"flipped bit", flipped, ErrCorrupt},
+		{"too new", build(formatVersion+1, nil), ErrVersion},
+		// the CRC is fine, but the last record runs past the end of the payload
+		{"record overrun", build(formatVersion, []byte{tagBrightness, 2, 4}), ErrCorrupt},
+		{"record header", build(formatVersion, []byte{tagBrightness}), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		s, err := Decode(tt.data)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		if !reflect.DeepEqual(s, Defaults()) {
+			t.Errorf("%s: got %+v, want defaults", tt.name, s)
+		}
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	payload := []byte{
+		// unknown and reserved tags are skipped
+		200, 3, 1, 2, 3,
+		tagNTPServer, 3, 'a', ':', '1',
+		tagBrightness, 1, 9,
+		// values of the wrong size keep the default
+		tagTalkCutoff, 1, 0xFF,
+		tagMicEnabled, 0,
+	}
+	s, err := Decode(build(formatVersion, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Defaults()
+	want.Brightness = 9
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+
+	// older versions decode the same way
+	if _, err := Decode(build(0, payload)); err != nil {
+		t.Errorf("version 0: %v", err)
+	}
+}
+
+func TestEncodeLongZone(t *testing.T) {
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = 'A'
+	}
+	s, err := Decode(Encode(Settings{TimeZone: string(long)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.TimeZone) != 0xFF {
+		t.Errorf("got %d bytes of time zone, want %d", len(s.TimeZone), 0xFF)
+	}
+}
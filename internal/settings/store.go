@@ -0,0 +1,58 @@
+package settings
+
+import (
+	"io"
+	"os"
+
+	"tinygo.org/x/tinyfs"
+)
+
+const (
+	fileName = "/settings.bin"
+	// written first, then renamed over fileName, so a power loss leaves either the old or the new settings intact
+	tmpName = "/settings.tmp"
+)
+
+// maximum size of the settings file we're willing to read
+const maxSize = 1024
+
+// Load reads the settings from fs. If there are none, or they can't be read, it returns Defaults along with the error.
+func Load(fs tinyfs.Filesystem) (Settings, error) {
+	// a leftover temporary file means we lost power while saving; the previous settings are still intact
+	_ = fs.Remove(tmpName)
+
+	f, err := fs.Open(fileName)
+	if err != nil {
+		return Defaults(), err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return Defaults(), err
+	}
+	if len(data) > maxSize {
+		return Defaults(), ErrCorrupt
+	}
+	return Decode(data)
+}
+
+// Save writes s to fs atomically.
+func Save(fs tinyfs.Filesystem, s Settings) error {
+	f, err := fs.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(Encode(s))
+	if err != nil {
+		_ = f.Close()
+		_ = fs.Remove(tmpName)
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		_ = fs.Remove(tmpName)
+		return err
+	}
+	return fs.Rename(tmpName, fileName)
+}
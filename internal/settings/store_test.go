@@ -0,0 +1,121 @@
+package settings
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"tinygo.org/x/tinyfs"
+	"tinygo.org/x/tinyfs/littlefs"
+)
+
+// newFS returns a freshly formatted littlefs volume on an in-memory block device.
+func newFS(t *testing.T) *littlefs.LFS {
+	t.Helper()
+	fs := littlefs.New(tinyfs.NewMemoryDevice(256, 4096, 64))
+	fs.Configure(&littlefs.Config{
+		CacheSize:     256,
+		LookaheadSize: 32,
+		BlockCycles:   100,
+	})
+	if err := fs.Format(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mount(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fs.Unmount() })
+	return fs
+}
+
+func writeFile(t *testing.T, fs tinyfs.Filesystem, name string, data []byte) {
+	t.Helper()
+	f, err := fs.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	fs := newFS(t)
+
+	s, err := Load(fs)
+	if err == nil {
+		t.Error("Load with no file: no error")
+	}
+	if !reflect.DeepEqual(s, Defaults()) {
+		t.Errorf("Load with no file = %+v, want defaults", s)
+	}
+
+	want := Settings{Brightness: 2, TalkCutoff: 3500, TouchEnabled: true, TimeZone: "JST-9", RTCOffset: 5}
+	if err := Save(fs, want); err != nil {
+		t.Fatal(err)
+	}
+	// saving again replaces the file rather than appending to it
+	want.Brightness = 3
+	if err := Save(fs, want); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Load(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Load = %+v, want %+v", s, want)
+	}
+	if _, err := fs.Stat(tmpName); err == nil {
+		t.Errorf("%s left behind after Save", tmpName)
+	}
+}
+
+func TestStoreInterruptedSave(t *testing.T) {
+	fs := newFS(t)
+	want := Settings{Brightness: 8, TalkCutoff: 2000}
+	if err := Save(fs, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// as if power was lost partway through writing the next save
+	writeFile(t, fs, tmpName, Encode(Settings{Brightness: 1})[:5])
+
+	s, err := Load(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Load = %+v, want %+v", s, want)
+	}
+	if _, err := fs.Stat(tmpName); err == nil {
+		t.Errorf("Load left %s behind", tmpName)
+	}
+}
+
+func TestStoreCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"garbage", []byte("not settings at all"), ErrCorrupt},
+		{"too big", make([]byte, maxSize+1), ErrCorrupt},
+		{"too new", build(formatVersion+1, nil), ErrVersion},
+	}
+	for _, tt := range tests {
+		fs := newFS(t)
+		writeFile(t, fs, fileName, tt.data)
+		s, err := Load(fs)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		if !reflect.DeepEqual(s, Defaults()) {
+			t.Errorf("%s: got %+v, want defaults", tt.name, s)
+		}
+	}
+}
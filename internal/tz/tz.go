@@ -0,0 +1,290 @@
+// Package tz turns POSIX TZ strings, such as "PST8PDT,M3.2.0,M11.1.0", into a *time.Location. TinyGo has no tzdata, so
+// this is how we get daylight saving time right.
+package tz
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrName   = errors.New("tz: bad zone name")
+	ErrOffset = errors.New("tz: bad offset")
+	ErrRule   = errors.New("tz: bad rule")
+	ErrSyntax = errors.New("tz: trailing characters")
+)
+
+// RuleKind is the form of a DST transition date.
+type RuleKind uint8
+
+const (
+	// RuleJulian is "Jn": day n (1-365) of the year, never counting February 29.
+	RuleJulian RuleKind = iota
+	// RuleDayOfYear is "n": day n (0-365) of the year, counting February 29 in leap years.
+	RuleDayOfYear
+	// RuleMonthWeekDay is "Mm.w.d": day d (0 = Sunday) of week w (1-5, 5 = last) of month m.
+	RuleMonthWeekDay
+)
+
+// Rule is a DST transition date and local time of day.
+type Rule struct {
+	Kind  RuleKind
+	Day   int
+	Week  int
+	Month int
+	// Time is the local time of day of the transition, in seconds. It may be negative or more than a day.
+	Time int
+}
+
+// Zone is a parsed POSIX TZ string.
+type Zone struct {
+	// TZ is the string the zone was parsed from.
+	TZ string
+
+	StdName string
+	// StdOffset is in seconds east of UTC. Note that this is the opposite sign from the TZ string.
+	StdOffset int
+
+	// DSTName is empty if the zone doesn't observe daylight saving time, in which case the remaining fields are
+	// unused.
+	DSTName   string
+	DSTOffset int
+	Start     Rule
+	End       Rule
+}
+
+// US rules, which are what glibc and Go assume when the rules are omitted
+var defaultRules = [2]Rule{
+	{Kind: RuleMonthWeekDay, Month: 3, Week: 2, Day: 0, Time: 2 * 60 * 60},
+	{Kind: RuleMonthWeekDay, Month: 11, Week: 1, Day: 0, Time: 2 * 60 * 60},
+}
+
+// Parse parses a POSIX TZ string: std offset [dst [offset] [,start[/time],end[/time]]].
+func Parse(s string) (*Zone, error) {
+	z := &Zone{TZ: s}
+	p := parser{s: s}
+
+	var err error
+	if z.StdName, err = p.name(); err != nil {
+		return nil, err
+	}
+	off, err := p.offset(24)
+	if err != nil {
+		return nil, err
+	}
+	z.StdOffset = -off
+	if p.done() {
+		return z, nil
+	}
+
+	if z.DSTName, err = p.name(); err != nil {
+		return nil, err
+	}
+	z.DSTOffset = z.StdOffset + 60*60
+	if !p.done() && p.peek() != ',' {
+		off, err := p.offset(24)
+		if err != nil {
+			return nil, err
+		}
+		z.DSTOffset = -off
+	}
+	if p.done() {
+		z.Start, z.End = defaultRules[0], defaultRules[1]
+		return z, nil
+	}
+
+	if !p.consume(',') {
+		return nil, ErrSyntax
+	}
+	if z.Start, err = p.rule(); err != nil {
+		return nil, err
+	}
+	if !p.consume(',') {
+		return nil, ErrRule
+	}
+	if z.End, err = p.rule(); err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, ErrSyntax
+	}
+	return z, nil
+}
+
+// Load parses s and returns the corresponding location.
+func Load(s string) (*time.Location, error) {
+	z, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return z.Location()
+}
+
+// Location returns a *time.Location for z.
+//
+// It builds a minimal TZif (RFC 8536) version 2 file with no transitions, and the TZ string as the footer. The time
+// package then evaluates the DST rules itself for any date.
+func (z *Zone) Location() (*time.Location, error) {
+	if z.DSTName == "" {
+		return time.FixedZone(z.StdName, z.StdOffset), nil
+	}
+	return time.LoadLocationFromTZData(z.TZ, z.tzif())
+}
+
+func (z *Zone) tzif() []byte {
+	// a single local time type for standard time; the footer covers every instant after it anyway
+	chars := z.StdName + "\x00"
+
+	// a version 2 file repeats the header and data, first with 32-bit then 64-bit times; with no transitions, the two
+	// are identical
+	var b []byte
+	for i := 0; i < 2; i++ {
+		b = append(b, "TZif2"...)
+		b = append(b, make([]byte, 15)...)
+		// isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt
+		for _, n := range []int{0, 0, 0, 0, 1, len(chars)} {
+			b = binary.BigEndian.AppendUint32(b, uint32(n))
+		}
+		// ttinfo: utoff, isdst, desigidx
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(z.StdOffset)))
+		b = append(b, 0, 0)
+		b = append(b, chars...)
+	}
+	b = append(b, '\n')
+	b = append(b, z.TZ...)
+	return append(b, '\n')
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.done() || p.s[p.pos] != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// name parses a zone abbreviation: at least three letters, or anything but '>' between angle brackets.
+func (p *parser) name() (string, error) {
+	start := p.pos
+	if p.consume('<') {
+		for !p.done() && p.peek() != '>' {
+			p.pos++
+		}
+		name := p.s[start+1 : p.pos]
+		if !p.consume('>') || len(name) < 3 {
+			return "", ErrName
+		}
+		return name, nil
+	}
+
+	for !p.done() && (p.peek() >= 'A' && p.peek() <= 'Z' || p.peek() >= 'a' && p.peek() <= 'z') {
+		p.pos++
+	}
+	if p.pos-start < 3 {
+		return "", ErrName
+	}
+	return p.s[start:p.pos], nil
+}
+
+// offset parses [+-]hh[:mm[:ss]] into seconds, with hours no more than maxHours.
+func (p *parser) offset(maxHours int) (int, error) {
+	sign := 1
+	if p.consume('-') {
+		sign = -1
+	} else {
+		p.consume('+')
+	}
+
+	h, ok := p.number(0, maxHours)
+	if !ok {
+		return 0, ErrOffset
+	}
+	secs := h * 60 * 60
+	if p.consume(':') {
+		m, ok := p.number(0, 59)
+		if !ok {
+			return 0, ErrOffset
+		}
+		secs += m * 60
+		if p.consume(':') {
+			s, ok := p.number(0, 59)
+			if !ok {
+				return 0, ErrOffset
+			}
+			secs += s
+		}
+	}
+	return sign * secs, nil
+}
+
+// rule parses a transition date with an optional /time.
+func (p *parser) rule() (Rule, error) {
+	var r Rule
+	var ok bool
+	switch {
+	case p.consume('J'):
+		r.Kind = RuleJulian
+		r.Day, ok = p.number(1, 365)
+	case p.consume('M'):
+		r.Kind = RuleMonthWeekDay
+		r.Month, ok = p.number(1, 12)
+		if ok && p.consume('.') {
+			r.Week, ok = p.number(1, 5)
+		} else {
+			ok = false
+		}
+		if ok && p.consume('.') {
+			r.Day, ok = p.number(0, 6)
+		} else {
+			ok = false
+		}
+	default:
+		r.Kind = RuleDayOfYear
+		r.Day, ok = p.number(0, 365)
+	}
+	if !ok {
+		return Rule{}, ErrRule
+	}
+
+	r.Time = 2 * 60 * 60
+	if p.consume('/') {
+		// RFC 8536 extends this to -167 through 167 hours
+		t, err := p.offset(167)
+		if err != nil {
+			return Rule{}, ErrRule
+		}
+		r.Time = t
+	}
+	return r, nil
+}
+
+// number parses a decimal number between min and max inclusive.
+func (p *parser) number(min, max int) (int, bool) {
+	start := p.pos
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if p.pos == start || p.pos-start > 3 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil || n < min || n > max {
+		return 0, false
+	}
+	return n, true
+}
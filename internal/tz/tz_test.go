@@ -0,0 +1,149 @@
+package tz
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tz   string
+		want Zone
+	}{
+		{"UTC0", Zone{StdName: "UTC"}},
+		{"JST-9", Zone{StdName: "JST", StdOffset: 9 * 60 * 60}},
+		{"<+0530>-5:30", Zone{StdName: "+0530", StdOffset: 5*60*60 + 30*60}},
+		{"PST8PDT", Zone{
+			StdName: "PST", StdOffset: -8 * 60 * 60,
+			DSTName: "PDT", DSTOffset: -7 * 60 * 60,
+			Start: defaultRules[0], End: defaultRules[1],
+		}},
+		{"GMT0BST,M3.5.0/1,M10.5.0", Zone{
+			StdName: "GMT",
+			DSTName: "BST", DSTOffset: 60 * 60,
+			Start: Rule{Kind: RuleMonthWeekDay, Month: 3, Week: 5, Day: 0, Time: 60 * 60},
+			End:   Rule{Kind: RuleMonthWeekDay, Month: 10, Week: 5, Day: 0, Time: 2 * 60 * 60},
+		}},
+		{"XXX3YYY2,J60/-1,300/26:30", Zone{
+			StdName: "XXX", StdOffset: -3 * 60 * 60,
+			DSTName: "YYY", DSTOffset: -2 * 60 * 60,
+			Start: Rule{Kind: RuleJulian, Day: 60, Time: -60 * 60},
+			End:   Rule{Kind: RuleDayOfYear, Day: 300, Time: 26*60*60 + 30*60},
+		}},
+	}
+	for _, tt := range tests {
+		z, err := Parse(tt.tz)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.tz, err)
+			continue
+		}
+		tt.want.TZ = tt.tz
+		if *z != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.tz, *z, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		tz   string
+		want error
+	}{
+		{"", ErrName},
+		{"UT0", ErrName},
+		{"<AB>0", ErrName},
+		{"<ABC0", ErrName},
+		{"UTC", ErrOffset},
+		{"UTC25", ErrOffset},
+		{"UTC1:60", ErrOffset},
+		{"PST8P", ErrName},
+		{"PST8PDT,M3.2.0", ErrRule},
+		{"PST8PDT,M13.2.0,M11.1.0", ErrRule},
+		{"PST8PDT,M3.6.0,M11.1.0", ErrRule},
+		{"PST8PDT,M3.2.7,M11.1.0", ErrRule},
+		{"PST8PDT,J0,M11.1.0", ErrRule},
+		{"PST8PDT,M3.2.0/168,M11.1.0", ErrRule},
+		{"PST8PDT,M3.2.0,M11.1.0x", ErrSyntax},
+		{"PST8PDT;M3.2.0,M11.1.0", ErrOffset},
+		{"UTC0,M3.2.0,M11.1.0", ErrName},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.tz); !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.tz, err, tt.want)
+		}
+	}
+}
+
+// TestTransitions checks the local offset one second either side of each DST transition in 2023 and 2024.
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		tz string
+		// the UTC instants at which DST starts and ends
+		start, end       time.Time
+		stdName, dstName string
+		std, dst         int
+	}{
+		{
+			tz:      "PST8PDT,M3.2.0,M11.1.0",
+			start:   time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC),
+			end:     time.Date(2023, 11, 5, 9, 0, 0, 0, time.UTC),
+			stdName: "PST", dstName: "PDT", std: -8 * 60 * 60, dst: -7 * 60 * 60,
+		},
+		{
+			// the rules default to the US ones
+			tz:      "PST8PDT",
+			start:   time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC),
+			end:     time.Date(2024, 11, 3, 9, 0, 0, 0, time.UTC),
+			stdName: "PST", dstName: "PDT", std: -8 * 60 * 60, dst: -7 * 60 * 60,
+		},
+		{
+			tz:      "GMT0BST,M3.5.0/1,M10.5.0",
+			start:   time.Date(2023, 3, 26, 1, 0, 0, 0, time.UTC),
+			end:     time.Date(2023, 10, 29, 1, 0, 0, 0, time.UTC),
+			stdName: "GMT", dstName: "BST", std: 0, dst: 60 * 60,
+		},
+		{
+			// March has five Sundays in 2024, so week 5 is the 31st
+			tz:      "GMT0BST,M3.5.0/1,M10.5.0",
+			start:   time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC),
+			end:     time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC),
+			stdName: "GMT", dstName: "BST", std: 0, dst: 60 * 60,
+		},
+		{
+			// southern hemisphere: DST spans the new year, and ends at 03:00 local daylight time
+			tz:      "NZST-12NZDT,M9.5.0,M4.1.0/3",
+			start:   time.Date(2023, 9, 23, 14, 0, 0, 0, time.UTC),
+			end:     time.Date(2023, 4, 1, 14, 0, 0, 0, time.UTC),
+			stdName: "NZST", dstName: "NZDT", std: 12 * 60 * 60, dst: 13 * 60 * 60,
+		},
+	}
+	for _, tt := range tests {
+		loc, err := Load(tt.tz)
+		if err != nil {
+			t.Errorf("Load(%q): %v", tt.tz, err)
+			continue
+		}
+		check := func(at time.Time, name string, offset int) {
+			t.Helper()
+			if n, o := at.In(loc).Zone(); n != name || o != offset {
+				t.Errorf("%s at %v: got %s %d, want %s %d", tt.tz, at, n, o, name, offset)
+			}
+		}
+		check(tt.start.Add(-time.Second), tt.stdName, tt.std)
+		check(tt.start, tt.dstName, tt.dst)
+		check(tt.end.Add(-time.Second), tt.dstName, tt.dst)
+		check(tt.end, tt.stdName, tt.std)
+	}
+}
+
+func TestFixedZone(t *testing.T) {
+	loc, err := Load("JST-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	if n, o := at.In(loc).Zone(); n != "JST" || o != 9*60*60 {
+		t.Errorf("got %s %d, want JST %d", n, o, 9*60*60)
+	}
+}
@@ -0,0 +1,134 @@
+//go:build tinygo
+
+package wifi
+
+import (
+	"net/netip"
+	"time"
+
+	"tinygo.org/x/drivers/netlink"
+	"tinygo.org/x/drivers/netlink/probe"
+)
+
+// Netlink is a Link using whichever network device tinygo's netlink probe finds on the board.
+//
+// based on https://github.com/tinygo-org/drivers/blob/release/examples/net/ntpclient/main.go
+type Netlink struct {
+	// Networks are the saved networks, in order of preference.
+	Networks []Network
+
+	linker    netlink.Netlinker
+	dever     addresser
+	connected string
+}
+
+type addresser interface {
+	Addr() (netip.Addr, error)
+}
+
+// scanner is implemented by network devices that can list the networks in range, such as the WiFiNINA co-processor
+// on the MatrixPortal.
+type scanner interface {
+	ScanNetworks() (uint8, error)
+	GetNetworkSSID(idx int) string
+}
+
+// netlink doesn't have WPA3 (yet?)
+var netlinkAuth = map[Auth]netlink.AuthType{
+	AuthWPA2:      netlink.AuthTypeWPA2,
+	AuthOpen:      netlink.AuthTypeOpen,
+	AuthWPA:       netlink.AuthTypeWPA,
+	AuthWPA2Mixed: netlink.AuthTypeWPA2Mixed,
+}
+
+// NewNetlink creates a Link that joins the most preferred of the given networks that is in range. The device is not
+// probed until the first Connect.
+func NewNetlink(networks []Network) *Netlink {
+	return &Netlink{
+		Networks: networks,
+	}
+}
+
+func (n *Netlink) Connect() error {
+	if n.connected != "" {
+		return nil
+	}
+	if len(n.Networks) == 0 {
+		return ErrNoNetworks
+	}
+	if n.linker == nil {
+		n.linker, n.dever = probe.Probe()
+		time.Sleep(1 * time.Second)
+	}
+
+	candidates := Pick(n.Networks, n.scan())
+	if len(candidates) == 0 {
+		return ErrNotInRange
+	}
+
+	nw, err := join(candidates, func(nw Network) error {
+		auth, ok := netlinkAuth[nw.Auth]
+		if !ok {
+			println("wifi", nw.SSID+":", nw.Auth.String(), "not supported")
+			return ErrAuth
+		}
+		err := n.linker.NetConnect(&netlink.ConnectParams{
+			Ssid:           nw.SSID,
+			Passphrase:     nw.Password,
+			AuthType:       auth,
+			ConnectTimeout: 10 * time.Second,
+		})
+		if err != nil {
+			println("wifi", nw.SSID+":", err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	n.connected = nw.SSID
+
+	// give DHCP a chance
+	time.Sleep(time.Second)
+	return nil
+}
+
+// scan returns the SSIDs in range, or nil if the device can't scan.
+func (n *Netlink) scan() []string {
+	s, ok := n.linker.(scanner)
+	if !ok {
+		return nil
+	}
+	count, err := s.ScanNetworks()
+	if err != nil {
+		println("wifi scan:", err.Error())
+		return nil
+	}
+
+	visible := make([]string, 0, count)
+	for i := 0; i < int(count); i++ {
+		ssid := s.GetNetworkSSID(i)
+		println("wifi scan:", ssid)
+		visible = append(visible, ssid)
+	}
+	return visible
+}
+
+func (n *Netlink) Disconnect() {
+	if n.connected == "" {
+		return
+	}
+	n.linker.NetDisconnect()
+	n.connected = ""
+}
+
+func (n *Netlink) SSID() string {
+	return n.connected
+}
+
+func (n *Netlink) Addr() (netip.Addr, error) {
+	if n.dever == nil {
+		return netip.Addr{}, ErrNotConnected
+	}
+	return n.dever.Addr()
+}
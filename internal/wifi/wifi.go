@@ -0,0 +1,126 @@
+// Package wifi brings the network link up and down, independently of what it is used for.
+package wifi
+
+import (
+	"errors"
+	"net/netip"
+)
+
+var (
+	// ErrNotConnected is returned when asking for the address of a link that has never been connected.
+	ErrNotConnected = errors.New("not connected")
+	// ErrNoNetworks is returned when connecting without any networks configured.
+	ErrNoNetworks = errors.New("no networks configured")
+	// ErrNotInRange is returned when a scan found none of the saved networks.
+	ErrNotInRange = errors.New("no saved network in range")
+	// ErrAuth is returned for an authentication type the network device can't do.
+	ErrAuth = errors.New("unsupported auth type")
+)
+
+// Auth is the kind of authentication a network uses.
+type Auth uint8
+
+const (
+	AuthWPA2 Auth = iota
+	AuthOpen
+	AuthWPA
+	AuthWPA2Mixed
+	AuthWPA3
+)
+
+var authNames = [...]string{
+	AuthWPA2:      "wpa2",
+	AuthOpen:      "open",
+	AuthWPA:       "wpa",
+	AuthWPA2Mixed: "wpa2-mixed",
+	AuthWPA3:      "wpa3",
+}
+
+func (a Auth) String() string {
+	if int(a) < len(authNames) {
+		return authNames[a]
+	}
+	return "unknown"
+}
+
+// ParseAuth parses the name of an authentication type, as returned by Auth.String.
+func ParseAuth(s string) (Auth, error) {
+	for i, name := range authNames {
+		if s == name {
+			return Auth(i), nil
+		}
+	}
+	return 0, ErrAuth
+}
+
+// Network is a saved Wi-Fi network.
+type Network struct {
+	SSID     string
+	Password string
+	Auth     Auth
+	// Priority orders networks when more than one is available; higher is preferred.
+	Priority int
+	// Hidden networks don't broadcast their SSID, so they never show up in a scan and are always tried.
+	Hidden bool
+}
+
+// Pick returns the saved networks, which must already be in order of preference, that are among those visible in a
+// scan, or hidden. If visible is nil, the scan wasn't possible, and all saved networks are returned to be tried in
+// turn.
+func Pick(saved []Network, visible []string) []Network {
+	if visible == nil {
+		return saved
+	}
+
+	var picked []Network
+	for _, n := range saved {
+		if n.Hidden {
+			picked = append(picked, n)
+			continue
+		}
+		for _, ssid := range visible {
+			if n.SSID == ssid {
+				picked = append(picked, n)
+				break
+			}
+		}
+	}
+	return picked
+}
+
+// join calls connect for each candidate in turn until one succeeds, and returns the one that did. If none do, the
+// error is the first one from actually trying to connect, which says more than an unsupported auth type would.
+func join(candidates []Network, connect func(Network) error) (Network, error) {
+	var authErr, connErr error
+	for _, nw := range candidates {
+		err := connect(nw)
+		if err == nil {
+			return nw, nil
+		}
+		switch {
+		case errors.Is(err, ErrAuth):
+			authErr = err
+		case connErr == nil:
+			connErr = err
+		}
+	}
+	if connErr != nil {
+		return Network{}, connErr
+	}
+	if authErr != nil {
+		return Network{}, authErr
+	}
+	return Network{}, ErrNotInRange
+}
+
+// Link is a network connection that can be brought up and down on demand.
+type Link interface {
+	// Connect joins the network and waits for an address. It is a no-op if already connected.
+	Connect() error
+	// Disconnect leaves the network.
+	Disconnect()
+	// SSID returns the name of the network currently joined, or "" if not connected.
+	SSID() string
+	// Addr returns the address assigned to this device.
+	Addr() (netip.Addr, error)
+}
@@ -0,0 +1,85 @@
+package wifi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseAuth(t *testing.T) {
+	for a := AuthWPA2; a <= AuthWPA3; a++ {
+		got, err := ParseAuth(a.String())
+		if err != nil || got != a {
+			t.Errorf("ParseAuth(%q) = %v, %v; want %v", a.String(), got, err, a)
+		}
+	}
+	for _, s := range []string{"", "WPA2", "wep", "unknown"} {
+		if _, err := ParseAuth(s); !errors.Is(err, ErrAuth) {
+			t.Errorf("ParseAuth(%q): got %v, want %v", s, err, ErrAuth)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	home := Network{SSID: "home", Priority: 10}
+	workshop := Network{SSID: "workshop"}
+	lab := Network{SSID: "badge lab", Hidden: true}
+	con := Network{SSID: "con", Priority: -1}
+	saved := []Network{home, lab, workshop, con}
+
+	tests := []struct {
+		name    string
+		visible []string
+		want    []Network
+	}{
+		{"no scan", nil, saved},
+		{"nothing visible", []string{}, []Network{lab}},
+		{"order kept", []string{"con", "neighbour", "home"}, []Network{home, lab, con}},
+		{"hidden also visible", []string{"badge lab", "workshop"}, []Network{lab, workshop}},
+		{"case sensitive", []string{"HOME"}, []Network{lab}},
+	}
+	for _, tt := range tests {
+		if got := Pick(saved, tt.visible); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errPassword := errors.New("bad password")
+	a := Network{SSID: "a"}
+	b := Network{SSID: "b"}
+	c := Network{SSID: "c"}
+
+	tests := []struct {
+		name    string
+		results map[string]error
+		want    Network
+		wantErr error
+	}{
+		{"first", map[string]error{}, a, nil},
+		{"fallback", map[string]error{"a": errTimeout, "b": ErrAuth}, c, nil},
+		// an unsupported auth type at the end doesn't hide why the others failed
+		{"first failure", map[string]error{"a": errPassword, "b": errTimeout, "c": ErrAuth}, Network{}, errPassword},
+		{"auth after failure", map[string]error{"a": ErrAuth, "b": errTimeout, "c": ErrAuth}, Network{}, errTimeout},
+		{"all auth", map[string]error{"a": ErrAuth, "b": ErrAuth, "c": ErrAuth}, Network{}, ErrAuth},
+	}
+	for _, tt := range tests {
+		var tried []string
+		got, err := join([]Network{a, b, c}, func(nw Network) error {
+			tried = append(tried, nw.SSID)
+			return tt.results[nw.SSID]
+		})
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+		if tt.wantErr == nil && tried[len(tried)-1] != tt.want.SSID {
+			t.Errorf("%s: kept trying after %s: %v", tt.name, tt.want.SSID, tried)
+		}
+	}
+
+	if _, err := join(nil, func(Network) error { return nil }); !errors.Is(err, ErrNotInRange) {
+		t.Errorf("no candidates: got %v, want %v", err, ErrNotInRange)
+	}
+}